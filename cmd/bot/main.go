@@ -2,23 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/illenko/incidently/internal/agent"
+	"github.com/illenko/incidently/internal/alerts"
+	"github.com/illenko/incidently/internal/api"
 	"github.com/illenko/incidently/internal/config"
 	islack "github.com/illenko/incidently/internal/slack"
 )
 
-func main() {
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+// Run modes. The mode is the first argument ("bot repl") or the -mode flag.
+const (
+	modeSlack    = "slack"
+	modeREPL     = "repl"
+	modeCLI      = "cli" // alias of repl
+	modeValidate = "validate"
+)
 
+func main() {
 	if err := run(); err != nil {
 		slog.Error("fatal error", "error", err)
 		os.Exit(1)
@@ -26,10 +34,36 @@ func main() {
 }
 
 func run() error {
+	mode := modeSlack
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		mode, args = args[0], args[1:]
+	}
 	configPath := flag.String("config", "config/config.yaml", "path to config file")
-	flag.Parse()
+	flag.StringVar(&mode, "mode", mode, "run mode: slack, repl (alias cli) for an interactive terminal session, or validate to check config and playbooks")
+	strict := flag.Bool("strict", false, "validate: fail on warnings too")
+	flag.CommandLine.Parse(args)
 
-	cfg, err := config.Load(*configPath)
+	if mode == modeValidate {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+		return runValidate(*configPath, *strict, os.Stdout)
+	}
+
+	var (
+		cfg *config.Config
+		err error
+	)
+	switch mode {
+	case modeSlack:
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		cfg, err = config.Load(*configPath)
+	case modeREPL, modeCLI:
+		// Keep the terminal for the conversation; only problems are logged.
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+		cfg, err = config.LoadLocal(*configPath)
+	default:
+		return fmt.Errorf("unknown mode %q (slack, repl, validate)", mode)
+	}
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
@@ -39,18 +73,29 @@ func run() error {
 		"mcp_servers", len(cfg.MCPServers),
 		"agents", len(cfg.Agents),
 		"playbooks_dir", cfg.PlaybooksDir,
+		"playbook_sources", len(cfg.PlaybookSources),
+		"session_backend", cfg.Sessions.Backend,
 	)
 	for _, mcp := range cfg.MCPServers {
-		slog.Info("mcp server configured", "name", mcp.Name, "url", mcp.URL)
+		slog.Info("mcp server configured", "name", mcp.Name, "transport", mcp.Transport, "address", mcp.Address())
 	}
 	for _, a := range cfg.Agents {
 		slog.Info("agent configured", "name", a.Name, "model", a.Model, "tools", a.Tools)
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	if mode != modeSlack {
+		// The REPL handles Ctrl-C itself to stop the running question.
+		signals = []os.Signal{syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
 	defer stop()
 
-	playbooks, err := agent.LoadPlaybooks(cfg.PlaybooksDir)
+	library := agent.NewPlaybookLibrary(cfg)
+	if err := library.Sync(ctx); err != nil {
+		slog.Warn("failed to fetch playbook sources", "error", err)
+	}
+	playbooks, err := library.Load()
 	if err != nil {
 		return fmt.Errorf("loading playbooks: %w", err)
 	}
@@ -61,9 +106,48 @@ func run() error {
 		return fmt.Errorf("creating agent service: %w", err)
 	}
 	defer svc.Close()
+	if down := svc.UnavailableSources(); len(down) > 0 {
+		slog.Warn("starting with unavailable MCP servers", "servers", down)
+	}
+	svc.WatchPlaybooks(ctx, library)
+
+	if mode != modeSlack {
+		return runREPL(ctx, svc, os.Stdin, os.Stdout)
+	}
+	return runSlack(ctx, cfg, svc)
+}
 
+// runSlack serves investigations from Slack, plus the alert webhook, API and
+// debug servers when configured, until ctx is cancelled.
+func runSlack(ctx context.Context, cfg *config.Config, svc *agent.Service) error {
 	gw := islack.NewGateway(cfg.Slack)
 
+	if cfg.Alerts.Listen != "" {
+		alertServer := alerts.NewServer(cfg.Alerts, gw)
+		go func() {
+			if err := alertServer.Run(ctx); err != nil {
+				slog.Error("alert webhook server stopped", "error", err)
+			}
+		}()
+	}
+
+	if cfg.API.Listen != "" {
+		apiServer := api.NewServer(cfg.API, svc)
+		go func() {
+			if err := apiServer.Run(ctx); err != nil {
+				slog.Error("api server stopped", "error", err)
+			}
+		}()
+	}
+
+	if cfg.Debug.Listen != "" {
+		go func() {
+			if err := serveDebug(ctx, cfg.Debug.Listen); err != nil {
+				slog.Error("debug server stopped", "error", err)
+			}
+		}()
+	}
+
 	slog.Info("starting slack gateway")
 	gw.Run(ctx, func(msg islack.Message) {
 		slog.Info("message received",
@@ -73,41 +157,48 @@ func run() error {
 			"text", msg.Text,
 		)
 
-		if err := gw.PostMessage(msg.Channel, msg.ThreadTS, "Investigating..."); err != nil {
+		invCtx, done := gw.BeginInvestigation(ctx, msg)
+		defer done()
+
+		progress := gw.NewProgressReporter(msg.Channel, msg.ThreadTS)
+		if err := progress.Start(); err != nil {
 			slog.Error("failed to send initial progress", "error", err, "thread", msg.ThreadTS)
 		}
 
-		var mu sync.Mutex
-		lastImmediate := time.Now()
-		lastBackground := time.Now()
-		onProgress := func(text string, immediate bool) {
-			mu.Lock()
-			defer mu.Unlock()
-			if immediate {
-				if time.Since(lastImmediate) < 5*time.Second {
-					return
-				}
-				lastImmediate = time.Now()
-			} else {
-				if time.Since(lastBackground) < time.Minute {
-					return
-				}
-				lastBackground = time.Now()
+		if !svc.HasSession(invCtx, msg.Channel, msg.ThreadTS) {
+			seedSession(invCtx, gw, svc, msg)
+		}
+
+		response, err := svc.HandleMessage(invCtx, agent.Request{
+			Channel:   msg.Channel,
+			ThreadTS:  msg.ThreadTS,
+			UserID:    msg.UserID,
+			UserName:  msg.UserName,
+			Text:      msg.Text,
+			Playbooks: msg.Playbooks,
+			Agents:    msg.Agents,
+		}, progress)
+		var cancelErr *islack.CancelError
+		if errors.As(err, &cancelErr) {
+			progress.Cancelled(cancelErr.UserID)
+			text := "Stopped. No findings were collected yet."
+			if response != "" {
+				text = "Stopped. Partial findings so far:\n\n" + response
 			}
-			slog.Debug("sending progress", "thread", msg.ThreadTS, "text", text, "immediate", immediate)
-			if err := gw.PostMessage(msg.Channel, msg.ThreadTS, text); err != nil {
-				slog.Error("failed to send progress", "error", err, "thread", msg.ThreadTS)
+			if postErr := gw.PostMessage(msg.Channel, msg.ThreadTS, text); postErr != nil {
+				slog.Error("failed to send partial findings", "error", postErr, "thread", msg.ThreadTS)
 			}
+			return
 		}
-
-		response, err := svc.HandleMessage(ctx, msg.UserID, msg.ThreadTS, msg.Text, onProgress)
 		if err != nil {
 			slog.Error("agent error", "error", err, "thread", msg.ThreadTS, "user", msg.UserID)
+			progress.Fail()
 			if postErr := gw.PostMessage(msg.Channel, msg.ThreadTS, "Sorry, something went wrong during analysis."); postErr != nil {
 				slog.Error("failed to send error message", "error", postErr, "thread", msg.ThreadTS)
 			}
 			return
 		}
+		progress.Finish()
 
 		slog.Info("sending final response", "thread", msg.ThreadTS, "length", len(response))
 		if err := gw.PostMessage(msg.Channel, msg.ThreadTS, response); err != nil {
@@ -117,3 +208,25 @@ func run() error {
 
 	return nil
 }
+
+// seedSession imports the thread's earlier messages when the bot is first
+// asked in an existing thread. Failures are logged and the investigation
+// continues without the history.
+func seedSession(ctx context.Context, gw *islack.Gateway, svc *agent.Service, msg islack.Message) {
+	history, err := gw.ThreadHistory(msg)
+	if err != nil {
+		slog.Warn("failed to fetch thread history", "error", err, "thread", msg.ThreadTS)
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	seed := make([]agent.ThreadMessage, len(history))
+	for i, m := range history {
+		seed[i] = agent.ThreadMessage{Author: m.Author, Text: m.Text, Time: m.Time}
+	}
+	if err := svc.SeedSession(ctx, msg.Channel, msg.ThreadTS, seed); err != nil {
+		slog.Error("failed to seed session with thread history", "error", err, "thread", msg.ThreadTS)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/illenko/incidently/internal/agent"
+)
+
+// replChannel is the session namespace for terminal sessions.
+const replChannel = "repl"
+
+const replHelp = `Ask a question to start an investigation; follow-ups continue the same session.
+Commands:
+  /new   start a new session
+  /help  show this help
+  /exit  quit (or Ctrl-D)
+Ctrl-C stops a running investigation, or quits at the prompt.`
+
+// runREPL runs investigations from questions typed in the terminal, printing
+// progress and the final report. All questions share one session until /new.
+func runREPL(ctx context.Context, svc *agent.Service, in io.Reader, out io.Writer) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	name := localUser()
+	sessionID := newREPLSession()
+	fmt.Fprintln(out, replHelp)
+
+	for {
+		fmt.Fprint(out, "\n> ")
+
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(out)
+				return nil
+			}
+			line = strings.TrimSpace(l)
+		case <-interrupts:
+			fmt.Fprintln(out)
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+
+		switch line {
+		case "":
+			continue
+		case "/exit", "/quit":
+			return nil
+		case "/help":
+			fmt.Fprintln(out, replHelp)
+			continue
+		case "/new":
+			sessionID = newREPLSession()
+			fmt.Fprintln(out, "Started a new session.")
+			continue
+		}
+
+		askREPL(ctx, svc, out, interrupts, agent.Request{
+			Channel:  replChannel,
+			ThreadTS: sessionID,
+			UserID:   name,
+			UserName: name,
+			Text:     line,
+		})
+	}
+}
+
+// askREPL runs one question, printing progress as it goes. An interrupt
+// stops the investigation and prints what was found so far.
+func askREPL(ctx context.Context, svc *agent.Service, out io.Writer, interrupts <-chan os.Signal, req agent.Request) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	started := time.Now()
+	var tokens int64
+	response, err := svc.HandleMessage(ctx, req, agent.EventHandlerFunc(func(e agent.Event) {
+		switch e.Kind {
+		case agent.EventTransfer:
+			fmt.Fprintf(out, "  %s → %s\n", e.Agent, e.TransferTo)
+		case agent.EventToolStarted:
+			fmt.Fprintf(out, "  %s: %s(%s)\n", e.Agent, e.Tool, e.Args)
+		case agent.EventToolFailed:
+			fmt.Fprintf(out, "  %s: %s failed after %s: %s\n", e.Agent, e.Tool, e.Duration.Round(time.Millisecond), e.Error)
+		case agent.EventUsage:
+			tokens += int64(e.Usage.TotalTokens)
+		}
+	}))
+	elapsed := time.Since(started).Round(time.Second)
+
+	switch {
+	case errors.Is(err, agent.ErrCancelled):
+		fmt.Fprintf(out, "\nStopped after %s.", elapsed)
+		if response == "" {
+			fmt.Fprintln(out, " No findings were collected yet.")
+			return
+		}
+		fmt.Fprintf(out, " Partial findings so far:\n\n%s\n", response)
+	case err != nil:
+		fmt.Fprintf(out, "\nError after %s: %v\n", elapsed, err)
+	default:
+		fmt.Fprintf(out, "\n%s\n\n(%s, %d tokens)\n", response, elapsed, tokens)
+	}
+}
+
+func newREPLSession() string {
+	return "repl-" + time.Now().UTC().Format("20060102-150405.000")
+}
+
+func localUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return cmp.Or(os.Getenv("USER"), "local user")
+}
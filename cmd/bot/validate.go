@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/illenko/incidently/internal/agent"
+	"github.com/illenko/incidently/internal/config"
+)
+
+// runValidate checks the config, instructions and playbooks without
+// connecting to anything, printing one line per problem. It fails if any
+// error is found, or any warning when strict is set, so playbook repositories
+// can gate merges on it. Slack, alert and API settings are not checked, and
+// git playbook sources only if they were fetched before.
+func runValidate(configPath string, strict bool, out io.Writer) error {
+	cfg, err := config.LoadLocal(configPath)
+	if err != nil {
+		fmt.Fprintf(out, "%s: error: %v\n", configPath, err)
+		return errors.New("validation failed: invalid config")
+	}
+
+	var issues []agent.LintIssue
+	instructions := []string{cfg.Coordinator.Instruction}
+	agents := make([]string, 0, len(cfg.Agents))
+	for _, a := range cfg.Agents {
+		instructions = append(instructions, a.Instruction)
+		agents = append(agents, a.Name)
+	}
+	for _, path := range instructions {
+		text, err := agent.LoadInstruction(path)
+		switch {
+		case err != nil:
+			issues = append(issues, agent.LintIssue{File: path, Severity: agent.LintError, Message: err.Error()})
+		case strings.TrimSpace(text) == "":
+			issues = append(issues, agent.LintIssue{File: path, Severity: agent.LintWarning, Message: "instruction file is empty"})
+		}
+	}
+
+	playbookIssues, err := agent.NewPlaybookLibrary(cfg).Lint(agents)
+	if err != nil {
+		return err
+	}
+	issues = append(issues, playbookIssues...)
+
+	errs, warnings := 0, 0
+	for _, issue := range issues {
+		fmt.Fprintln(out, issue)
+		if issue.Severity == agent.LintError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Fprintf(out, "%d errors, %d warnings\n", errs, warnings)
+
+	if errs > 0 || (strict && warnings > 0) {
+		return fmt.Errorf("validation failed: %d errors, %d warnings", errs, warnings)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/genai"
+)
+
+type limitsKey struct{}
+
+// limits restrict a request to some playbooks and specialists. Empty lists
+// mean no limit.
+type limits struct {
+	playbooks []string // glob patterns
+	agents    []string
+}
+
+func (l limits) empty() bool {
+	return len(l.playbooks) == 0 && len(l.agents) == 0
+}
+
+func withLimits(ctx context.Context, req Request) context.Context {
+	l := limits{playbooks: req.Playbooks, agents: req.Agents}
+	if l.empty() {
+		return ctx
+	}
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+func limitsFrom(ctx context.Context) limits {
+	l, _ := ctx.Value(limitsKey{}).(limits)
+	return l
+}
+
+func playbookAllowed(ctx context.Context, name string) bool {
+	l := limitsFrom(ctx)
+	if len(l.playbooks) == 0 {
+		return true
+	}
+	for _, pattern := range l.playbooks {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func agentAllowed(ctx context.Context, name string) bool {
+	l := limitsFrom(ctx)
+	return len(l.agents) == 0 || slices.Contains(l.agents, name)
+}
+
+// limitsNote describes a request's limits for the coordinator, or returns ""
+// when there are none.
+func limitsNote(req Request) string {
+	var parts []string
+	if len(req.Playbooks) > 0 {
+		parts = append(parts, "playbooks matching "+strings.Join(req.Playbooks, ", "))
+	}
+	if len(req.Agents) > 0 {
+		parts = append(parts, "specialists "+strings.Join(req.Agents, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// checkAgentAllowed stops a specialist from running for a request that may
+// not use it.
+func checkAgentAllowed(ctx agent.CallbackContext) (*genai.Content, error) {
+	if agentAllowed(ctx, ctx.AgentName()) {
+		return nil, nil
+	}
+	slog.Warn("specialist not allowed for request", "agent", ctx.AgentName(), "session", ctx.SessionID())
+	return genai.NewContentFromText(
+		fmt.Sprintf("The %s specialist is not available for this request.", ctx.AgentName()),
+		genai.RoleModel,
+	), nil
+}
@@ -2,101 +2,90 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/illenko/incidently/internal/config"
-	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
 	"google.golang.org/adk/model/gemini"
 	"google.golang.org/adk/runner"
 	"google.golang.org/adk/session"
 	"google.golang.org/adk/tool"
-	"google.golang.org/adk/tool/functiontool"
-	"google.golang.org/adk/tool/mcptoolset"
+	"google.golang.org/adk/util/instructionutil"
 	"google.golang.org/genai"
 )
 
 type Service struct {
-	runner   *runner.Runner
-	sessions session.Service
-	toolsets []tool.Toolset
+	runner       *runner.Runner
+	sessions     session.Service
+	sessionStore io.Closer
+	mcpServers   map[string]*mcpServer
+	playbooks    *playbookStore
+
+	// agentsByServer lists the specialists that depend on each MCP server.
+	agentsByServer map[string][]string
 }
 
-type GetPlaybookArgs struct {
-	Name string `json:"name" jsonschema:"Name of the playbook to load"`
-}
+// ErrCancelled is returned by HandleMessage when its context is cancelled
+// mid-investigation. The returned text then holds the partial findings
+// collected so far, and the error wraps the context's cancellation cause.
+var ErrCancelled = errors.New("investigation cancelled")
 
-type GetPlaybookResult struct {
-	Content string `json:"content"`
-}
+// transferToAgentTool is the function ADK uses for delegation; it is reported
+// as a transfer rather than a tool call.
+const transferToAgentTool = "transfer_to_agent"
 
-func NewService(ctx context.Context, cfg *config.Config, playbooks []Playbook) (*Service, error) {
+func NewService(ctx context.Context, cfg *config.Config, playbooks []Playbook) (_ *Service, err error) {
 	slog.Info("initializing agent service")
 
-	mcpToolsets := make(map[string]tool.Toolset)
-	var allToolsets []tool.Toolset
-
-	for _, srv := range cfg.MCPServers {
-		slog.Info("creating MCP toolset", "name", srv.Name, "url", srv.URL)
-		transport := &mcp.SSEClientTransport{Endpoint: srv.URL}
-
-		mcpClient := mcp.NewClient(&mcp.Implementation{Name: "incidently", Version: "1.0"}, nil)
-		mcpSession, err := mcpClient.Connect(ctx, transport, nil)
+	mcpServers := make(map[string]*mcpServer)
+	// Stop the reconnect loops and stdio server processes if setup fails.
+	defer func() {
 		if err != nil {
-			return nil, fmt.Errorf("connecting to MCP server %s: %w", srv.Name, err)
+			closeMCPServers(mcpServers)
 		}
-		toolsResult, err := mcpSession.ListTools(ctx, &mcp.ListToolsParams{})
+	}()
+
+	for _, srv := range cfg.MCPServers {
+		slog.Info("connecting to MCP server", "name", srv.Name, "transport", srv.Transport, "address", srv.Address())
+		server, err := newMCPServer(ctx, srv)
 		if err != nil {
-			return nil, fmt.Errorf("listing tools from MCP server %s: %w", srv.Name, err)
+			return nil, fmt.Errorf("MCP server %s: %w", srv.Name, err)
 		}
-		for _, t := range toolsResult.Tools {
-			slog.Info("MCP tool available", "server", srv.Name, "tool", t.Name, "description", t.Description)
+		mcpServers[srv.Name] = server
+		if err := server.Start(); err != nil {
+			slog.Error("MCP server unavailable at startup, continuing without it", "name", srv.Name, "error", err)
+			continue
 		}
-		mcpSession.Close()
+		server.logCatalog()
+		slog.Info("MCP server connected", "name", srv.Name, "tools", len(server.Catalog()))
+	}
 
-		transport2 := &mcp.SSEClientTransport{Endpoint: srv.URL}
-		ts, err := mcptoolset.New(mcptoolset.Config{Transport: transport2})
-		if err != nil {
-			return nil, fmt.Errorf("creating MCP toolset %s: %w", srv.Name, err)
+	agentsByServer := make(map[string][]string)
+	for _, a := range cfg.Agents {
+		for _, srv := range a.Tools {
+			agentsByServer[srv] = append(agentsByServer[srv], a.Name)
 		}
-		mcpToolsets[srv.Name] = ts
-		allToolsets = append(allToolsets, ts)
-		slog.Info("MCP toolset created", "name", srv.Name)
 	}
 
-	playbookMap := make(map[string]string)
-	for _, pb := range playbooks {
-		playbookMap[pb.Name] = pb.Content
-	}
-	slog.Info("registered playbooks for get_playbook tool", "count", len(playbookMap))
+	store := newPlaybookStore(playbooks)
+	slog.Info("registered playbooks for playbook tools", "count", len(playbooks))
 
-	getPlaybookTool, err := functiontool.New(
-		functiontool.Config{
-			Name:        "get_playbook",
-			Description: "Loads the full content of a playbook by name. Use this to get detailed investigation steps.",
-		},
-		func(ctx tool.Context, args GetPlaybookArgs) (GetPlaybookResult, error) {
-			content, ok := playbookMap[args.Name]
-			if !ok {
-				slog.Warn("playbook not found", "name", args.Name)
-				return GetPlaybookResult{}, fmt.Errorf("playbook %q not found", args.Name)
-			}
-			slog.Info("playbook loaded by coordinator", "name", args.Name, "size_bytes", len(content))
-			return GetPlaybookResult{Content: content}, nil
-		},
-	)
+	playbookTools, err := newPlaybookTools(store)
 	if err != nil {
-		return nil, fmt.Errorf("creating get_playbook tool: %w", err)
+		return nil, err
 	}
 
 	var subAgents []agent.Agent
 	for _, agentCfg := range cfg.Agents {
 		slog.Info("building specialist agent", "name", agentCfg.Name, "model", agentCfg.Model, "tools", agentCfg.Tools)
-		a, err := buildAgent(ctx, agentCfg, mcpToolsets)
+		a, err := buildAgent(ctx, agentCfg, mcpServers)
 		if err != nil {
 			return nil, fmt.Errorf("building agent %s: %w", agentCfg.Name, err)
 		}
@@ -105,16 +94,24 @@ func NewService(ctx context.Context, cfg *config.Config, playbooks []Playbook) (
 	}
 
 	slog.Info("building coordinator", "model", cfg.Coordinator.Model, "sub_agents", len(subAgents))
-	coordinator, err := buildCoordinator(ctx, cfg.Coordinator, playbooks, getPlaybookTool, subAgents)
+	coordinator, err := buildCoordinator(ctx, cfg.Coordinator, store, playbookTools, subAgents)
 	if err != nil {
 		return nil, fmt.Errorf("building coordinator: %w", err)
 	}
 	slog.Info("coordinator ready")
 
-	sessionService := session.InMemoryService()
+	sessionService, sessionStore, err := newSessionService(ctx, cfg.Sessions)
+	if err != nil {
+		return nil, fmt.Errorf("creating session service: %w", err)
+	}
+	defer func() {
+		if err != nil && sessionStore != nil {
+			sessionStore.Close()
+		}
+	}()
 
 	r, err := runner.New(runner.Config{
-		AppName:        "incidently",
+		AppName:        appName,
 		Agent:          coordinator,
 		SessionService: sessionService,
 	})
@@ -124,29 +121,49 @@ func NewService(ctx context.Context, cfg *config.Config, playbooks []Playbook) (
 
 	slog.Info("agent service initialized")
 	return &Service{
-		runner:   r,
-		sessions: sessionService,
-		toolsets: allToolsets,
+		runner:         r,
+		sessions:       sessionService,
+		sessionStore:   sessionStore,
+		mcpServers:     mcpServers,
+		playbooks:      store,
+		agentsByServer: agentsByServer,
 	}, nil
 }
 
+// Request is a message from someone in a conversation thread. Everyone in the
+// thread shares one session, keyed by Channel and ThreadTS.
+type Request struct {
+	Channel  string
+	ThreadTS string
+	UserID   string
+	UserName string
+	Text     string
+	// Playbooks (glob patterns) and Agents limit what the request may use;
+	// empty means no limit.
+	Playbooks []string
+	Agents    []string
+}
+
+// HandleMessage runs one turn of the thread's session and returns the final
+// response. Progress is reported to events, which may be nil.
 func (s *Service) HandleMessage(
 	ctx context.Context,
-	userID, threadTS, text string,
-	onProgress func(text string, immediate bool),
+	req Request,
+	events EventHandler,
 ) (string, error) {
-	slog.Info("handling message", "user", userID, "thread", threadTS, "text", text)
+	threadTS := req.ThreadTS
+	slog.Info("handling message", "user", req.UserID, "channel", req.Channel, "thread", threadTS, "text", req.Text)
 
 	_, err := s.sessions.Get(ctx, &session.GetRequest{
-		AppName:   "incidently",
-		UserID:    userID,
+		AppName:   appName,
+		UserID:    req.Channel,
 		SessionID: threadTS,
 	})
 	if err != nil {
-		slog.Info("creating new session", "user", userID, "thread", threadTS)
+		slog.Info("creating new session", "channel", req.Channel, "thread", threadTS)
 		_, err = s.sessions.Create(ctx, &session.CreateRequest{
-			AppName:   "incidently",
-			UserID:    userID,
+			AppName:   appName,
+			UserID:    req.Channel,
 			SessionID: threadTS,
 		})
 		if err != nil {
@@ -154,12 +171,25 @@ func (s *Service) HandleMessage(
 		}
 	}
 
-	textWithTime := fmt.Sprintf("[Current time: %s]\n\n%s", time.Now().UTC().Format("2006-01-02 15:04 UTC"), text)
-	msg := genai.NewContentFromText(textWithTime, genai.RoleUser)
+	header := fmt.Sprintf("[Current time: %s]", time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+	header += fmt.Sprintf("\n[From: %s]", requester(req))
+	if note := limitsNote(req); note != "" {
+		header += fmt.Sprintf("\n[Access limited to: %s]", note)
+	}
+	if unavailable := s.unavailableSourcesNote(); unavailable != "" {
+		slog.Warn("data sources unavailable", "thread", threadTS, "sources", unavailable)
+		header += fmt.Sprintf("\n[Unavailable data sources: %s]", unavailable)
+	}
+	msg := genai.NewContentFromText(header+"\n\n"+req.Text, genai.RoleUser)
+	ctx = withLimits(ctx, req)
 
 	var parts []string
+	translator := newEventTranslator(events)
 
-	for event, err := range s.runner.Run(ctx, userID, threadTS, msg, agent.RunConfig{}) {
+	for event, err := range s.runner.Run(ctx, req.Channel, threadTS, msg, agent.RunConfig{}) {
+		if ctx.Err() != nil {
+			break
+		}
 		if err != nil {
 			slog.Error("runner event error", "error", err, "thread", threadTS)
 			return "", fmt.Errorf("agent error: %w", err)
@@ -171,21 +201,20 @@ func (s *Service) HandleMessage(
 				"to", event.Actions.TransferToAgent,
 				"thread", threadTS,
 			)
-			onProgress(fmt.Sprintf("Delegating to %s...", event.Actions.TransferToAgent), true)
 		}
 
 		if event.Content != nil {
 			for _, part := range event.Content.Parts {
-				if part.FunctionCall != nil {
+				if part.FunctionCall != nil && part.FunctionCall.Name != transferToAgentTool {
 					slog.Debug("tool call",
 						"agent", event.Author,
 						"tool", part.FunctionCall.Name,
 						"thread", threadTS,
 					)
-					onProgress(fmt.Sprintf("_%s_ is working...", event.Author), false)
 				}
 			}
 		}
+		translator.translate(event)
 
 		if event.IsFinalResponse() {
 			slog.Debug("final response from agent", "agent", event.Author, "thread", threadTS)
@@ -200,21 +229,82 @@ func (s *Service) HandleMessage(
 	}
 
 	result := strings.Join(parts, "\n")
+	if ctx.Err() != nil {
+		slog.Info("message handling cancelled", "thread", threadTS, "partial_length", len(result), "cause", context.Cause(ctx))
+		return result, fmt.Errorf("%w: %w", ErrCancelled, context.Cause(ctx))
+	}
 	slog.Info("message handled", "thread", threadTS, "response_length", len(result))
+	translator.emit(Event{Kind: EventFinal, Text: result})
 	return result, nil
 }
 
+// requester names who sent a request, e.g. "Jane Doe (U123ABC)".
+func requester(req Request) string {
+	switch {
+	case req.UserName != "" && req.UserID != "" && req.UserName != req.UserID:
+		return fmt.Sprintf("%s (%s)", req.UserName, req.UserID)
+	case req.UserName != "":
+		return req.UserName
+	case req.UserID != "":
+		return req.UserID
+	}
+	return "unknown"
+}
+
 func (s *Service) Close() {
 	slog.Info("closing agent service")
-	for _, ts := range s.toolsets {
-		if closer, ok := ts.(interface{ Close() }); ok {
-			closer.Close()
+	closeMCPServers(s.mcpServers)
+	if s.sessionStore != nil {
+		if err := s.sessionStore.Close(); err != nil {
+			slog.Error("failed to close session store", "error", err)
 		}
 	}
 	slog.Info("agent service closed")
 }
 
-func buildAgent(ctx context.Context, cfg config.AgentConfig, mcpToolsets map[string]tool.Toolset) (agent.Agent, error) {
+// MCPCatalog returns the tools discovered on each connected MCP server, keyed by server name.
+func (s *Service) MCPCatalog() map[string][]tool.Tool {
+	catalog := make(map[string][]tool.Tool, len(s.mcpServers))
+	for name, server := range s.mcpServers {
+		catalog[name] = server.Catalog()
+	}
+	return catalog
+}
+
+// UnavailableSources returns the names of MCP servers that are currently down.
+func (s *Service) UnavailableSources() []string {
+	var names []string
+	for name, server := range s.mcpServers {
+		if !server.Available() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unavailableSourcesNote describes the servers that are down and the
+// specialists affected, e.g. "grafana (used by system-monitoring)".
+func (s *Service) unavailableSourcesNote() string {
+	var notes []string
+	for _, name := range s.UnavailableSources() {
+		if agents := s.agentsByServer[name]; len(agents) > 0 {
+			name = fmt.Sprintf("%s (used by %s)", name, strings.Join(agents, ", "))
+		}
+		notes = append(notes, name)
+	}
+	return strings.Join(notes, "; ")
+}
+
+func closeMCPServers(servers map[string]*mcpServer) {
+	for name, server := range servers {
+		if err := server.Close(); err != nil {
+			slog.Error("failed to close MCP connection", "server", name, "error", err)
+		}
+	}
+}
+
+func buildAgent(ctx context.Context, cfg config.AgentConfig, mcpServers map[string]*mcpServer) (agent.Agent, error) {
 	m, err := gemini.NewModel(ctx, cfg.Model, &genai.ClientConfig{
 		Backend: genai.BackendGeminiAPI,
 	})
@@ -228,13 +318,44 @@ func buildAgent(ctx context.Context, cfg config.AgentConfig, mcpToolsets map[str
 	}
 	slog.Debug("loaded instruction", "agent", cfg.Name, "path", cfg.Instruction, "size_bytes", len(instruction))
 
+	filter := newToolFilter(cfg)
+	catalogs := make(map[string][]string)
 	var agentToolsets []tool.Toolset
-	for _, toolName := range cfg.Tools {
-		if ts, ok := mcpToolsets[toolName]; ok {
-			agentToolsets = append(agentToolsets, ts)
+	for _, serverName := range cfg.Tools {
+		server, ok := mcpServers[serverName]
+		if !ok {
+			continue
+		}
+		agentToolsets = append(agentToolsets, filter.apply(serverName, server.Toolset()))
+
+		if !server.Available() {
+			catalogs[serverName] = nil
+			continue
+		}
+		names := make([]string, 0, len(server.Catalog()))
+		for _, t := range server.Catalog() {
+			names = append(names, t.Name())
+		}
+		catalogs[serverName] = names
+		if !filter.empty() {
+			var allowed []string
+			for _, name := range names {
+				if filter.allows(serverName, name) {
+					allowed = append(allowed, name)
+				}
+			}
+			slog.Info("agent tools filtered", "agent", cfg.Name, "server", serverName, "allowed", allowed, "total", len(names))
 		}
 	}
 
+	warnings, err := filter.validate(catalogs)
+	for _, w := range warnings {
+		slog.Warn("tool filter warning", "agent", cfg.Name, "warning", w)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validating tool filter: %w", err)
+	}
+
 	return llmagent.New(llmagent.Config{
 		Name:        cfg.Name,
 		Description: cfg.Description,
@@ -243,15 +364,16 @@ func buildAgent(ctx context.Context, cfg config.AgentConfig, mcpToolsets map[str
 		GenerateContentConfig: &genai.GenerateContentConfig{
 			Temperature: genai.Ptr(float32(cfg.Temperature)),
 		},
-		Toolsets: agentToolsets,
+		Toolsets:             agentToolsets,
+		BeforeAgentCallbacks: []agent.BeforeAgentCallback{checkAgentAllowed},
 	})
 }
 
 func buildCoordinator(
 	ctx context.Context,
 	cfg config.CoordinatorConfig,
-	playbooks []Playbook,
-	getPlaybookTool tool.Tool,
+	playbooks *playbookStore,
+	playbookTools []tool.Tool,
 	subAgents []agent.Agent,
 ) (agent.Agent, error) {
 	m, err := gemini.NewModel(ctx, cfg.Model, &genai.ClientConfig{
@@ -267,18 +389,25 @@ func buildCoordinator(
 	}
 	slog.Debug("loaded coordinator instruction", "path", cfg.Instruction, "size_bytes", len(instruction))
 
-	playbookIndex := BuildPlaybookIndex(playbooks)
-	slog.Debug("built playbook index", "size_bytes", len(playbookIndex))
-
 	return llmagent.New(llmagent.Config{
 		Name:        "coordinator",
 		Description: cfg.Description,
 		Model:       m,
-		Instruction: instruction + "\n\n" + playbookIndex,
+		// The playbook index is read on every model call, so it follows
+		// playbook reloads. A provider's result is used verbatim, so the
+		// {state} placeholders that Instruction supports are injected here,
+		// into the instruction only; playbook text is left as written.
+		InstructionProvider: func(ctx agent.ReadonlyContext) (string, error) {
+			text, err := instructionutil.InjectSessionState(ctx, instruction)
+			if err != nil {
+				return "", fmt.Errorf("injecting session state into the coordinator instruction: %w", err)
+			}
+			return text + "\n\n" + playbooks.index(), nil
+		},
 		GenerateContentConfig: &genai.GenerateContentConfig{
 			Temperature: genai.Ptr(float32(cfg.Temperature)),
 		},
 		SubAgents: subAgents,
-		Tools:     []tool.Tool{getPlaybookTool},
+		Tools:     playbookTools,
 	})
 }
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+// EventKind identifies what happened in an investigation step.
+type EventKind string
+
+const (
+	// EventTransfer: Agent delegated to TransferTo.
+	EventTransfer EventKind = "transfer"
+	// EventToolStarted: Agent called Tool with Args.
+	EventToolStarted EventKind = "tool_started"
+	// EventToolFinished: the call CallID returned after Duration.
+	EventToolFinished EventKind = "tool_finished"
+	// EventToolFailed: the call CallID returned Error after Duration.
+	EventToolFailed EventKind = "tool_failed"
+	// EventText: Agent produced Text. Partial is set for streamed chunks.
+	EventText EventKind = "text"
+	// EventFinal: the investigation finished with the response in Text.
+	EventFinal EventKind = "final"
+	// EventUsage: one model call of Agent used Usage tokens.
+	EventUsage EventKind = "usage"
+)
+
+// Event is one step of a running investigation. Only the fields relevant to
+// Kind are set.
+type Event struct {
+	Kind       EventKind     `json:"kind"`
+	Time       time.Time     `json:"time"`
+	Agent      string        `json:"agent,omitempty"`
+	TransferTo string        `json:"transfer_to,omitempty"`
+	Tool       string        `json:"tool,omitempty"`
+	CallID     string        `json:"call_id,omitempty"`
+	Args       string        `json:"args,omitempty"`
+	Duration   time.Duration `json:"duration_ns,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Text       string        `json:"text,omitempty"`
+	Partial    bool          `json:"partial,omitempty"`
+	Usage      *Usage        `json:"usage,omitempty"`
+}
+
+// Usage is the token count of one model call.
+type Usage struct {
+	PromptTokens   int32 `json:"prompt_tokens"`
+	ResponseTokens int32 `json:"response_tokens"`
+	TotalTokens    int32 `json:"total_tokens"`
+}
+
+// EventHandler receives the events of an investigation in order. HandleEvent
+// is called on the investigation's goroutine and should return quickly.
+type EventHandler interface {
+	HandleEvent(Event)
+}
+
+// EventHandlerFunc adapts a function to an EventHandler.
+type EventHandlerFunc func(Event)
+
+func (f EventHandlerFunc) HandleEvent(e Event) { f(e) }
+
+const (
+	maxArgsSummary = 200
+	maxArgValue    = 60
+)
+
+// eventTranslator turns ADK session events into investigation events,
+// pairing tool calls with their responses.
+type eventTranslator struct {
+	handler EventHandler
+	calls   map[string]time.Time // call ID -> start
+}
+
+func newEventTranslator(handler EventHandler) *eventTranslator {
+	return &eventTranslator{handler: handler, calls: make(map[string]time.Time)}
+}
+
+func (t *eventTranslator) emit(e Event) {
+	if t.handler == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	t.handler.HandleEvent(e)
+}
+
+func (t *eventTranslator) translate(event *session.Event) {
+	now := time.Now()
+	if event.Actions.TransferToAgent != "" {
+		t.emit(Event{Kind: EventTransfer, Time: now, Agent: event.Author, TransferTo: event.Actions.TransferToAgent})
+	}
+	if event.Content != nil {
+		t.translateParts(event, now)
+	}
+	if usage := event.UsageMetadata; usage != nil && !event.Partial {
+		t.emit(Event{Kind: EventUsage, Time: now, Agent: event.Author, Usage: &Usage{
+			PromptTokens:   usage.PromptTokenCount,
+			ResponseTokens: usage.CandidatesTokenCount,
+			TotalTokens:    usage.TotalTokenCount,
+		}})
+	}
+}
+
+func (t *eventTranslator) translateParts(event *session.Event, now time.Time) {
+	for _, part := range event.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			call := part.FunctionCall
+			if call.Name == transferToAgentTool {
+				continue
+			}
+			t.calls[call.ID] = now
+			t.emit(Event{Kind: EventToolStarted, Time: now, Agent: event.Author, Tool: call.Name, CallID: call.ID, Args: summarizeArgs(call.Args)})
+
+		case part.FunctionResponse != nil:
+			resp := part.FunctionResponse
+			if resp.Name == transferToAgentTool {
+				continue
+			}
+			e := Event{Kind: EventToolFinished, Time: now, Agent: event.Author, Tool: resp.Name, CallID: resp.ID}
+			if started, ok := t.calls[resp.ID]; ok {
+				e.Duration = now.Sub(started)
+				delete(t.calls, resp.ID)
+			}
+			if msg, ok := resp.Response["error"]; ok {
+				e.Kind = EventToolFailed
+				e.Error = fmt.Sprint(msg)
+			}
+			t.emit(e)
+
+		case part.Text != "" && !part.Thought:
+			t.emit(Event{Kind: EventText, Time: now, Agent: event.Author, Text: part.Text, Partial: event.Partial})
+		}
+	}
+}
+
+// summarizeArgs renders tool arguments as short key=value pairs for display.
+func summarizeArgs(args map[string]any) string {
+	pairs := make([]string, 0, len(args))
+	for _, k := range slices.Sorted(maps.Keys(args)) {
+		var value string
+		if s, ok := args[k].(string); ok {
+			value = s
+		} else {
+			b, _ := json.Marshal(args[k])
+			value = string(b)
+		}
+		pairs = append(pairs, k+"="+truncate(value, maxArgValue))
+	}
+	return truncate(strings.Join(pairs, ", "), maxArgsSummary)
+}
+
+func truncate(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > limit {
+		return string(r[:limit-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// ThreadMessage is a message posted in the conversation before the bot was
+// asked, such as what responders discussed in an incident thread.
+type ThreadMessage struct {
+	Author string
+	Text   string
+	Time   time.Time
+}
+
+// HasSession reports whether the thread already has a session.
+func (s *Service) HasSession(ctx context.Context, channel, threadTS string) bool {
+	_, err := s.sessions.Get(ctx, &session.GetRequest{
+		AppName:   appName,
+		UserID:    channel,
+		SessionID: threadTS,
+	})
+	return err == nil
+}
+
+// DeleteSession removes the thread's session and its history from the
+// session store.
+func (s *Service) DeleteSession(ctx context.Context, channel, threadTS string) error {
+	err := s.sessions.Delete(ctx, &session.DeleteRequest{
+		AppName:   appName,
+		UserID:    channel,
+		SessionID: threadTS,
+	})
+	if err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	return nil
+}
+
+// SeedSession creates the session for a thread with its earlier messages
+// recorded as context, so the coordinator knows what responders have already
+// found before the first request.
+func (s *Service) SeedSession(ctx context.Context, channel, threadTS string, history []ThreadMessage) error {
+	created, err := s.sessions.Create(ctx, &session.CreateRequest{
+		AppName:   appName,
+		UserID:    channel,
+		SessionID: threadTS,
+	})
+	if err != nil {
+		return fmt.Errorf("creating session: %w", err)
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("[Earlier messages in this thread, before you were asked]")
+	for _, m := range history {
+		fmt.Fprintf(&b, "\n[%s] %s: %s", m.Time.UTC().Format("2006-01-02 15:04 UTC"), m.Author, m.Text)
+	}
+
+	event := session.NewEvent("thread-history")
+	event.Author = "user"
+	event.Content = genai.NewContentFromText(b.String(), genai.RoleUser)
+	if err := s.sessions.AppendEvent(ctx, created.Session, event); err != nil {
+		return fmt.Errorf("recording thread history: %w", err)
+	}
+
+	slog.Info("session seeded with thread history", "channel", channel, "thread", threadTS, "messages", len(history))
+	return nil
+}
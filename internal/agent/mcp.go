@@ -0,0 +1,299 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/config"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/mcptoolset"
+	"google.golang.org/genai"
+)
+
+const (
+	mcpKeepAlive           = 30 * time.Second
+	mcpReconnectMinBackoff = 2 * time.Second
+	mcpReconnectMaxBackoff = 2 * time.Minute
+)
+
+// mcpServer manages one configured MCP server. Its tools are served by ADK's
+// mcptoolset over a single client session; mcpTransport builds a fresh
+// underlying transport for each connection attempt, and the server tracks the
+// session that mcptoolset establishes to know whether the server is up. The
+// tool catalog is refreshed whenever the toolset lists tools, so it always
+// matches what agents are given.
+//
+// A server that cannot be reached is marked unavailable and reconnected in the
+// background with exponential backoff; while it is down its toolset is empty.
+type mcpServer struct {
+	name    string
+	toolset tool.Toolset
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu           sync.RWMutex
+	session      *mcp.ClientSession
+	reconnecting bool
+	catalog      []tool.Tool
+}
+
+// newMCPServer prepares a server connection. The context bounds background
+// reconnect attempts; call Close to stop them.
+func newMCPServer(ctx context.Context, cfg config.MCPServerConfig) (*mcpServer, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &mcpServer{
+		name:   cfg.Name,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "incidently", Version: "1.0"}, &mcp.ClientOptions{
+		KeepAlive: mcpKeepAlive,
+	})
+	client.AddSendingMiddleware(s.trackSession)
+
+	ts, err := mcptoolset.New(mcptoolset.Config{
+		Client:    client,
+		Transport: &mcpTransport{newTransport: transportFactory(cfg)},
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("creating MCP toolset: %w", err)
+	}
+	s.toolset = ts
+	return s, nil
+}
+
+// Start makes the initial connection. On failure the server is marked
+// unavailable and retried in the background; the error is returned for logging.
+func (s *mcpServer) Start() error {
+	if err := s.refreshCatalog(s.ctx); err != nil {
+		s.disconnected(nil, err)
+		return err
+	}
+	return nil
+}
+
+// refreshCatalog lists the server's tools through the toolset, which
+// connects or reconnects as needed.
+func (s *mcpServer) refreshCatalog(ctx context.Context) error {
+	tools, err := s.toolset.Tools(listContext{ctx})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.catalog = tools
+	s.mu.Unlock()
+	return nil
+}
+
+// trackSession is client middleware that records each session mcptoolset
+// completes the handshake on, and watches it until it ends.
+func (s *mcpServer) trackSession(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res, err := next(ctx, method, req)
+		if err != nil || method != "notifications/initialized" {
+			return res, err
+		}
+		session, ok := req.GetSession().(*mcp.ClientSession)
+		if !ok {
+			return res, err
+		}
+
+		s.mu.Lock()
+		s.session = session
+		s.reconnecting = false
+		s.mu.Unlock()
+		go s.watch(session)
+		return res, err
+	}
+}
+
+// watch reports the session as lost when it ends without Close being called,
+// e.g. after failed keepalive pings.
+func (s *mcpServer) watch(session *mcp.ClientSession) {
+	err := session.Wait()
+	if err == nil {
+		err = mcp.ErrConnectionClosed
+	}
+	s.disconnected(session, err)
+}
+
+// disconnected drops a broken session and starts reconnecting in the background.
+func (s *mcpServer) disconnected(broken *mcp.ClientSession, cause error) {
+	s.mu.Lock()
+	if s.ctx.Err() != nil || s.session != broken || s.reconnecting {
+		s.mu.Unlock()
+		return
+	}
+	s.session = nil
+	s.reconnecting = true
+	s.mu.Unlock()
+
+	if broken != nil {
+		broken.Close()
+	}
+	slog.Warn("MCP server unavailable, reconnecting in background", "server", s.name, "error", cause)
+	go s.reconnectLoop()
+}
+
+// reconnectLoop lists tools with backoff until it succeeds, which makes
+// mcptoolset replace the broken session. A tool call may reconnect first.
+func (s *mcpServer) reconnectLoop() {
+	backoff := mcpReconnectMinBackoff
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if s.Available() {
+			return
+		}
+		if err := s.refreshCatalog(s.ctx); err != nil {
+			backoff = min(backoff*2, mcpReconnectMaxBackoff)
+			slog.Debug("MCP reconnect failed", "server", s.name, "error", err, "retry_in", backoff)
+			continue
+		}
+
+		slog.Info("MCP server reconnected", "server", s.name, "tools", len(s.Catalog()))
+		s.logCatalog()
+		return
+	}
+}
+
+// mcpTransport is the transport mcptoolset connects with. Each connection
+// needs a fresh underlying transport, since a stdio command can only be
+// started once; rebuilding the HTTP client also picks up rotated certificates.
+type mcpTransport struct {
+	newTransport func() (mcp.Transport, error)
+}
+
+func (t *mcpTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	transport, err := t.newTransport()
+	if err != nil {
+		return nil, fmt.Errorf("creating transport: %w", err)
+	}
+	return transport.Connect(ctx)
+}
+
+// transportFactory returns a constructor for the configured transport.
+func transportFactory(cfg config.MCPServerConfig) func() (mcp.Transport, error) {
+	switch cfg.Transport {
+	case config.TransportStreamable:
+		return func() (mcp.Transport, error) {
+			client, err := newMCPHTTPClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.StreamableClientTransport{Endpoint: cfg.Endpoint, HTTPClient: client}, nil
+		}
+	case config.TransportStdio:
+		return func() (mcp.Transport, error) {
+			cmd := exec.Command(cfg.Command, cfg.Args...)
+			cmd.Env = os.Environ()
+			for k, v := range cfg.Env {
+				cmd.Env = append(cmd.Env, k+"="+v)
+			}
+			cmd.Stderr = os.Stderr
+			return &mcp.CommandTransport{Command: cmd}, nil
+		}
+	default:
+		return func() (mcp.Transport, error) {
+			client, err := newMCPHTTPClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.SSEClientTransport{Endpoint: cfg.URL, HTTPClient: client}, nil
+		}
+	}
+}
+
+// Available reports whether the server currently has a live connection.
+func (s *mcpServer) Available() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.session != nil
+}
+
+// Catalog returns the tools discovered on the server. It keeps the last known
+// catalog while the server is unavailable.
+func (s *mcpServer) Catalog() []tool.Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.catalog
+}
+
+func (s *mcpServer) logCatalog() {
+	for _, t := range s.Catalog() {
+		slog.Info("MCP tool available", "server", s.name, "tool", t.Name(), "description", t.Description())
+	}
+}
+
+// Toolset exposes the server's tools to an agent; it is empty while the
+// server is unavailable.
+func (s *mcpServer) Toolset() tool.Toolset {
+	return &mcpToolset{server: s}
+}
+
+func (s *mcpServer) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session == nil {
+		return nil
+	}
+	err := s.session.Close()
+	s.session = nil
+	return err
+}
+
+// mcpToolset hides a server's mcptoolset while the server is down, so agents
+// keep working with their other tools instead of failing every model call.
+type mcpToolset struct {
+	server *mcpServer
+}
+
+func (ts *mcpToolset) Name() string {
+	return "mcp_" + ts.server.name
+}
+
+func (ts *mcpToolset) Tools(ctx agent.ReadonlyContext) ([]tool.Tool, error) {
+	if !ts.server.Available() {
+		return nil, nil
+	}
+	tools, err := ts.server.toolset.Tools(ctx)
+	if err != nil {
+		slog.Warn("failed to list MCP tools, continuing without them", "server", ts.server.name, "error", err)
+		return nil, nil
+	}
+	ts.server.mu.Lock()
+	ts.server.catalog = tools
+	ts.server.mu.Unlock()
+	return tools, nil
+}
+
+// listContext lets the service list a toolset's tools outside an agent
+// invocation; mcptoolset only uses it as a context.
+type listContext struct {
+	context.Context
+}
+
+func (listContext) UserContent() *genai.Content          { return nil }
+func (listContext) InvocationID() string                 { return "" }
+func (listContext) AgentName() string                    { return "" }
+func (listContext) ReadonlyState() session.ReadonlyState { return nil }
+func (listContext) UserID() string                       { return "" }
+func (listContext) AppName() string                      { return "" }
+func (listContext) SessionID() string                    { return "" }
+func (listContext) Branch() string                       { return "" }
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/config"
+)
+
+// newMCPHTTPClient builds the HTTP client used by SSE and Streamable HTTP
+// transports. It returns nil when the server needs no authentication, so the
+// transport falls back to its default client.
+func newMCPHTTPClient(cfg config.MCPServerConfig) (*http.Client, error) {
+	if len(cfg.Headers) == 0 && cfg.BearerTokenFile == "" && cfg.TLS == (config.TLSConfig{}) {
+		return nil, nil
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.TLS != (config.TLSConfig{}) {
+		tlsCfg, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		base.TLSClientConfig = tlsCfg
+	}
+
+	rt := &authTransport{
+		base:    base,
+		headers: cfg.Headers,
+	}
+	if cfg.BearerTokenFile != "" {
+		rt.token = &tokenFile{path: cfg.BearerTokenFile}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	return tlsCfg, nil
+}
+
+// authTransport adds static headers and a bearer token to every request.
+type authTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	token   *tokenFile
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if t.token != nil {
+		token, err := t.token.Get()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// tokenFile caches a bearer token read from disk and re-reads it when the
+// file's modification time or size changes, so rotated tokens are picked up
+// without a restart.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func (f *tokenFile) Get() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if f.token != "" {
+			return f.token, nil
+		}
+		return "", fmt.Errorf("reading bearer token file: %w", err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("reading bearer token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("bearer token file %s is empty", f.path)
+	}
+
+	f.token = token
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return f.token, nil
+}
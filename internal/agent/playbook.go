@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -14,74 +16,191 @@ type Playbook struct {
 	Name        string
 	Description string
 	Tags        []string
-	Content     string
+	// Agents optionally lists the specialists the playbook delegates to.
+	Agents   []string
+	Content  string
+	Sections []PlaybookSection
+}
+
+// PlaybookSection is a part of a playbook body under a "##" heading, up to
+// the next one. Content includes the heading line.
+type PlaybookSection struct {
+	Heading string
+	Content string
 }
 
 type playbookFrontmatter struct {
 	Description string   `yaml:"description"`
 	Tags        []string `yaml:"tags"`
+	Agents      []string `yaml:"agents"`
 }
 
-func LoadPlaybooks(dir string) ([]Playbook, error) {
-	entries, err := os.ReadDir(dir)
+// LoadPlaybooks loads the playbooks in dir and its subdirectories. A
+// playbook's name is its path below dir without ".md", after prefix:
+// "payments/apple-pay".
+func LoadPlaybooks(dir, prefix string) ([]Playbook, error) {
+	files, err := playbookFiles(dir, prefix)
 	if err != nil {
-		return nil, fmt.Errorf("reading playbooks directory: %w", err)
+		return nil, err
 	}
 
-	slog.Info("loading playbooks", "dir", dir)
+	slog.Info("loading playbooks", "dir", dir, "prefix", prefix)
 
 	var playbooks []Playbook
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
-			continue
-		}
-
-		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
-		if err != nil {
-			return nil, fmt.Errorf("reading playbook %s: %w", entry.Name(), err)
-		}
-
-		pb, err := parsePlaybook(entry.Name(), string(data))
+	for _, file := range files {
+		pb, err := readPlaybook(file)
 		if err != nil {
-			return nil, fmt.Errorf("parsing playbook %s: %w", entry.Name(), err)
+			return nil, err
 		}
-
-		slog.Info("playbook loaded", "name", pb.Name, "description", pb.Description, "tags", pb.Tags)
 		playbooks = append(playbooks, pb)
 	}
 
 	return playbooks, nil
 }
 
-func parsePlaybook(filename, raw string) (Playbook, error) {
-	name := strings.TrimSuffix(filename, ".md")
+func readPlaybook(file playbookFile) (Playbook, error) {
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		return Playbook{}, fmt.Errorf("reading playbook %s: %w", file.path, err)
+	}
 
-	const delimiter = "---"
-	content := raw
+	pb, err := parsePlaybook(file.name, string(data))
+	if err != nil {
+		return Playbook{}, fmt.Errorf("parsing playbook %s: %w", file.path, err)
+	}
 
-	var fm playbookFrontmatter
-	if strings.HasPrefix(strings.TrimSpace(raw), delimiter) {
-		trimmed := strings.TrimSpace(raw)
-		rest := trimmed[len(delimiter):]
-		end := strings.Index(rest, delimiter)
-		if end != -1 {
-			frontmatterRaw := rest[:end]
-			content = strings.TrimSpace(rest[end+len(delimiter):])
-
-			if err := yaml.Unmarshal([]byte(frontmatterRaw), &fm); err != nil {
-				return Playbook{}, fmt.Errorf("parsing frontmatter: %w", err)
+	slog.Info("playbook loaded", "name", pb.Name, "description", pb.Description, "tags", pb.Tags)
+	return pb, nil
+}
+
+type playbookFile struct {
+	path string
+	name string
+}
+
+// playbookFiles lists the Markdown files below dir with their playbook
+// names. Hidden files and directories (such as .git) and READMEs are skipped.
+func playbookFiles(dir, prefix string) ([]playbookFile, error) {
+	var files []playbookFile
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		hidden := strings.HasPrefix(d.Name(), ".") && p != dir
+		if d.IsDir() {
+			if hidden {
+				return filepath.SkipDir
 			}
+			return nil
+		}
+		if hidden || !strings.HasSuffix(d.Name(), ".md") || strings.EqualFold(d.Name(), "README.md") {
+			return nil
 		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".md")
+		if prefix != "" {
+			name = prefix + "/" + name
+		}
+		files = append(files, playbookFile{path: p, name: name})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading playbooks directory: %w", err)
+	}
+	return files, nil
+}
+
+func parsePlaybook(name, raw string) (Playbook, error) {
+	var fm playbookFrontmatter
+	frontmatterRaw, content, err := splitFrontmatter(raw)
+	if err != nil {
+		return Playbook{}, err
+	}
+	if err := yaml.Unmarshal([]byte(frontmatterRaw), &fm); err != nil {
+		return Playbook{}, fmt.Errorf("parsing frontmatter: %w", err)
 	}
 
 	return Playbook{
 		Name:        name,
 		Description: fm.Description,
 		Tags:        fm.Tags,
+		Agents:      fm.Agents,
 		Content:     content,
+		Sections:    parseSections(content),
 	}, nil
 }
 
+// splitFrontmatter separates the YAML frontmatter between "---" lines from
+// the Markdown body. Only a line that is exactly "---" delimits it, so the
+// sequence inside a YAML value or a body line does not. A file without
+// frontmatter has an empty one.
+func splitFrontmatter(raw string) (frontmatter, body string, err error) {
+	const delimiter = "---"
+	trimmed := strings.TrimSpace(strings.ReplaceAll(raw, "\r\n", "\n"))
+	first, rest, _ := strings.Cut(trimmed, "\n")
+	if strings.TrimRight(first, " \t") != delimiter {
+		return "", trimmed, nil
+	}
+
+	lines := strings.Split(rest, "\n")
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t") == delimiter {
+			return strings.Join(lines[:i], "\n"), strings.TrimSpace(strings.Join(lines[i+1:], "\n")), nil
+		}
+	}
+	return "", "", errors.New("frontmatter is not terminated by ---")
+}
+
+// parseSections splits a playbook body at its "##" headings, ignoring lines
+// in code blocks. Text before the first heading belongs to no section.
+func parseSections(content string) []PlaybookSection {
+	var sections []PlaybookSection
+	var lines []string
+	heading, fenced := "", false
+	flush := func() {
+		if heading != "" {
+			sections = append(sections, PlaybookSection{
+				Heading: heading,
+				Content: strings.TrimSpace(strings.Join(lines, "\n")),
+			})
+		}
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+		if title, ok := strings.CutPrefix(line, "## "); ok && !fenced {
+			flush()
+			heading, lines = strings.TrimSpace(title), nil
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return sections
+}
+
+// Section returns the section with the given heading, ignoring case.
+func (p Playbook) Section(heading string) (PlaybookSection, bool) {
+	for _, s := range p.Sections {
+		if strings.EqualFold(s.Heading, strings.TrimSpace(heading)) {
+			return s, true
+		}
+	}
+	return PlaybookSection{}, false
+}
+
+func (p Playbook) SectionHeadings() []string {
+	headings := make([]string, len(p.Sections))
+	for i, s := range p.Sections {
+		headings[i] = s.Heading
+	}
+	return headings
+}
+
 func LoadInstruction(path string) (string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -98,6 +217,12 @@ func BuildPlaybookIndex(playbooks []Playbook) string {
 		if len(pb.Tags) > 0 {
 			b.WriteString(fmt.Sprintf(" [tags: %s]", strings.Join(pb.Tags, ", ")))
 		}
+		if len(pb.Agents) > 0 {
+			b.WriteString(fmt.Sprintf(" [agents: %s]", strings.Join(pb.Agents, ", ")))
+		}
+		if len(pb.Sections) > 0 {
+			b.WriteString(fmt.Sprintf(" [sections: %s]", strings.Join(pb.SectionHeadings(), "; ")))
+		}
 		b.WriteString("\n")
 	}
 	return b.String()
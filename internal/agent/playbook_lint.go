@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxPlaybookBytes is the body size above which a playbook is reported as
+// too large; the coordinator loads whole playbooks into its context.
+const maxPlaybookBytes = 20000
+
+// frontmatterFields are the fields of playbookFrontmatter.
+var frontmatterFields = []string{"description", "tags", "agents"}
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is a problem found in a playbook file.
+type LintIssue struct {
+	File     string
+	Severity LintSeverity
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.File, i.Severity, i.Message)
+}
+
+// Lint checks the library's playbooks for problems that Load accepts or
+// that make a playbook hard for the coordinator to use. agents are the
+// configured specialist names that playbooks may reference. Git sources are
+// checked only if they have been fetched.
+func (l *PlaybookLibrary) Lint(agents []string) ([]LintIssue, error) {
+	var issues []LintIssue
+	names := make(map[string]string) // lower-case name -> file
+	for _, src := range l.sources {
+		if src.isGit() {
+			if _, err := os.Stat(src.root); err != nil {
+				continue
+			}
+		}
+		files, err := playbookFiles(src.root, src.cfg.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("playbook source %s: %w", src.cfg.Name, err)
+		}
+		for _, file := range files {
+			issues = append(issues, lintPlaybook(file, names, agents)...)
+		}
+	}
+	return issues, nil
+}
+
+func lintPlaybook(file playbookFile, names map[string]string, agents []string) []LintIssue {
+	var issues []LintIssue
+	report := func(severity LintSeverity, format string, args ...any) {
+		issues = append(issues, LintIssue{File: file.path, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		report(LintError, "%v", err)
+		return issues
+	}
+
+	key := strings.ToLower(file.name)
+	if other, ok := names[key]; ok {
+		report(LintError, "playbook name %q is also used by %s", file.name, other)
+	} else {
+		names[key] = file.path
+	}
+
+	raw := string(data)
+	if !strings.HasPrefix(strings.TrimSpace(raw), "---") {
+		report(LintError, "no frontmatter; add a description and tags between --- lines")
+		lintBody(strings.TrimSpace(raw), report)
+		return issues
+	}
+	frontmatter, body, err := splitFrontmatter(raw)
+	if err != nil {
+		report(LintError, "%v", err)
+		return issues
+	}
+	lintFrontmatter(frontmatter, agents, report)
+	lintBody(body, report)
+	return issues
+}
+
+func lintFrontmatter(frontmatter string, agents []string, report func(LintSeverity, string, ...any)) {
+	var fm playbookFrontmatter
+	if err := yaml.Unmarshal([]byte(frontmatter), &fm); err != nil {
+		report(LintError, "invalid frontmatter: %v", err)
+		return
+	}
+
+	// Misspelled fields are otherwise silently ignored.
+	var fields map[string]any
+	yaml.Unmarshal([]byte(frontmatter), &fields)
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		if !slices.Contains(frontmatterFields, field) {
+			report(LintWarning, "unknown frontmatter field %q", field)
+		}
+	}
+
+	if strings.TrimSpace(fm.Description) == "" {
+		report(LintError, "missing description; the coordinator picks playbooks by their description")
+	}
+	if len(fm.Tags) == 0 {
+		report(LintWarning, "no tags; tags help the coordinator match requests to the playbook")
+	}
+	for _, name := range fm.Agents {
+		if !slices.Contains(agents, name) {
+			report(LintError, "references agent %q, which is not configured", name)
+		}
+	}
+}
+
+func lintBody(body string, report func(LintSeverity, string, ...any)) {
+	switch {
+	case body == "":
+		report(LintError, "empty body")
+	case len(body) > maxPlaybookBytes:
+		report(LintWarning, "body is %d bytes (over %d); consider splitting the playbook", len(body), maxPlaybookBytes)
+	}
+}
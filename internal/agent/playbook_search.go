@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters; the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Field weights: a term in a playbook's name or tags says more about it than
+// the same term somewhere in a section body.
+const (
+	nameWeight    = 3
+	tagWeight     = 3
+	headingWeight = 2
+)
+
+const maxSnippetRunes = 240
+
+// searchDoc is one searchable unit: a playbook section, or the text before
+// its first section.
+type searchDoc struct {
+	playbook string
+	section  string
+	body     string
+	terms    map[string]int
+	length   int
+}
+
+// searchIndex is an in-memory BM25 index over playbook sections.
+type searchIndex struct {
+	docs      []searchDoc
+	docFreq   map[string]int
+	avgLength float64
+}
+
+// SearchResult is a playbook section matching a search query.
+type SearchResult struct {
+	Playbook string  `json:"playbook"`
+	Section  string  `json:"section,omitempty"`
+	Score    float64 `json:"score"`
+	Snippet  string  `json:"snippet"`
+}
+
+func newSearchIndex(playbooks []Playbook) *searchIndex {
+	idx := &searchIndex{docFreq: make(map[string]int)}
+	for _, pb := range playbooks {
+		var shared []string
+		for range nameWeight {
+			shared = append(shared, tokenize(pb.Name)...)
+		}
+		for range tagWeight {
+			for _, tag := range pb.Tags {
+				shared = append(shared, tokenize(tag)...)
+			}
+		}
+		shared = append(shared, tokenize(pb.Description)...)
+
+		intro := pb.Content
+		if len(pb.Sections) > 0 {
+			if i := strings.Index(pb.Content, pb.Sections[0].Content); i >= 0 {
+				intro = pb.Content[:i]
+			}
+		}
+		// An intro that is only the title would rank on the name and tags
+		// alone, ahead of the sections that say something.
+		if snippet(intro, nil) != "" {
+			idx.add(pb.Name, "", intro, append(slices.Clone(shared), tokenize(intro)...))
+		}
+
+		for _, s := range pb.Sections {
+			terms := slices.Clone(shared)
+			for range headingWeight {
+				terms = append(terms, tokenize(s.Heading)...)
+			}
+			idx.add(pb.Name, s.Heading, s.Content, append(terms, tokenize(s.Content)...))
+		}
+	}
+
+	total := 0
+	for _, d := range idx.docs {
+		total += d.length
+	}
+	if len(idx.docs) > 0 {
+		idx.avgLength = float64(total) / float64(len(idx.docs))
+	}
+	return idx
+}
+
+func (idx *searchIndex) add(playbook, section, body string, tokens []string) {
+	terms := make(map[string]int)
+	for _, t := range tokens {
+		terms[t]++
+	}
+	for t := range terms {
+		idx.docFreq[t]++
+	}
+	idx.docs = append(idx.docs, searchDoc{
+		playbook: playbook,
+		section:  section,
+		body:     body,
+		terms:    terms,
+		length:   len(tokens),
+	})
+}
+
+// search returns up to limit sections ranked by BM25 score, keeping only
+// playbooks for which allowed returns true.
+func (idx *searchIndex) search(query string, limit int, allowed func(string) bool) []SearchResult {
+	queryTerms := unique(tokenize(query))
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	n := float64(len(idx.docs))
+	var results []SearchResult
+	for _, d := range idx.docs {
+		if !allowed(d.playbook) {
+			continue
+		}
+		score := 0.0
+		for _, t := range queryTerms {
+			tf := float64(d.terms[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := 1 - bm25B + bm25B*float64(d.length)/idx.avgLength
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+		if score > 0 {
+			results = append(results, SearchResult{
+				Playbook: d.playbook,
+				Section:  d.section,
+				Score:    math.Round(score*100) / 100,
+				Snippet:  snippet(d.body, queryTerms),
+			})
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b SearchResult) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// snippet returns the line of body that contains the most query terms, or
+// its first line of text if none does.
+func snippet(body string, queryTerms []string) string {
+	best, bestHits := "", 0
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "```") {
+			continue
+		}
+		if best == "" {
+			best = line
+		}
+		hits := 0
+		lineTerms := tokenize(line)
+		for _, t := range queryTerms {
+			if slices.Contains(lineTerms, t) {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = line, hits
+		}
+	}
+	if r := []rune(best); len(r) > maxSnippetRunes {
+		best = string(r[:maxSnippetRunes-1]) + "…"
+	}
+	return best
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "has": true, "in": true, "is": true, "it": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "were": true, "what": true, "when": true, "with": true, "why": true,
+}
+
+// tokenize splits text into lower-case terms, dropping stop words and
+// reducing plurals so "payments" matches "payment".
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		if stopWords[w] {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+	return terms
+}
+
+func stem(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") && !strings.HasSuffix(w, "us"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func unique(terms []string) []string {
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/config"
+)
+
+const (
+	defaultGitRef       = "HEAD"
+	defaultGitInterval  = 5 * time.Minute
+	defaultGitCacheRoot = "data/playbook-sources"
+	gitTimeout          = 2 * time.Minute
+)
+
+// PlaybookLibrary loads playbooks from playbooks_dir and the configured
+// playbook sources.
+type PlaybookLibrary struct {
+	sources []*playbookSource
+}
+
+// playbookSource is one directory tree of playbooks, local or a git checkout.
+type playbookSource struct {
+	cfg  config.PlaybookSourceConfig
+	root string // directory the playbooks are loaded from
+
+	// mu is held for writing while a git checkout rewrites root, so a
+	// reload never reads a half-updated tree.
+	mu     sync.RWMutex
+	commit string
+
+	// parsed caches the playbooks of the last load by file path, so a
+	// reload only parses files that changed.
+	parsedMu sync.Mutex
+	parsed   map[string]parsedPlaybook
+}
+
+type parsedPlaybook struct {
+	name     string
+	modTime  time.Time
+	size     int64
+	playbook Playbook
+}
+
+func NewPlaybookLibrary(cfg *config.Config) *PlaybookLibrary {
+	var configs []config.PlaybookSourceConfig
+	if cfg.PlaybooksDir != "" {
+		configs = append(configs, config.PlaybookSourceConfig{Name: "playbooks_dir", Path: cfg.PlaybooksDir})
+	}
+	configs = append(configs, cfg.PlaybookSources...)
+
+	lib := &PlaybookLibrary{}
+	for _, c := range configs {
+		src := &playbookSource{cfg: c, root: c.Path}
+		if c.Type == config.PlaybookSourceGit {
+			src.cfg.Ref = cmp.Or(c.Ref, defaultGitRef)
+			src.cfg.Interval = cmp.Or(c.Interval, defaultGitInterval)
+			src.cfg.CacheDir = cmp.Or(c.CacheDir, filepath.Join(defaultGitCacheRoot, c.Name))
+			src.root = filepath.Join(src.cfg.CacheDir, c.Path)
+		}
+		lib.sources = append(lib.sources, src)
+	}
+	return lib
+}
+
+// Load loads the playbooks of every source. It fails if any playbook fails
+// to load or two sources define the same name. A git source that has never
+// been fetched is skipped.
+func (l *PlaybookLibrary) Load() ([]Playbook, error) {
+	var all []Playbook
+	owners := make(map[string]string) // playbook name -> source
+	for _, src := range l.sources {
+		playbooks, err := src.load()
+		if err != nil {
+			return nil, fmt.Errorf("playbook source %s: %w", src.cfg.Name, err)
+		}
+		for _, pb := range playbooks {
+			if other, ok := owners[pb.Name]; ok {
+				return nil, fmt.Errorf("playbook %q is defined in both the %s and %s sources", pb.Name, other, src.cfg.Name)
+			}
+			owners[pb.Name] = src.cfg.Name
+		}
+		all = append(all, playbooks...)
+	}
+	return all, nil
+}
+
+// load returns the source's playbooks. Files unchanged since the last load
+// are not parsed again; the cache is only replaced when every file loads.
+func (s *playbookSource) load() ([]Playbook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.isGit() {
+		if _, err := os.Stat(s.root); err != nil {
+			slog.Warn("git playbook source not fetched yet, skipping", "source", s.cfg.Name, "dir", s.root)
+			return nil, nil
+		}
+	}
+
+	files, err := playbookFiles(s.root, s.cfg.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.parsedMu.Lock()
+	defer s.parsedMu.Unlock()
+	parsed := make(map[string]parsedPlaybook, len(files))
+	playbooks := make([]Playbook, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("reading playbook %s: %w", file.path, err)
+		}
+		entry, ok := s.parsed[file.path]
+		if !ok || entry.name != file.name || !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() {
+			pb, err := readPlaybook(file)
+			if err != nil {
+				return nil, err
+			}
+			entry = parsedPlaybook{name: file.name, modTime: info.ModTime(), size: info.Size(), playbook: pb}
+		}
+		parsed[file.path] = entry
+		playbooks = append(playbooks, entry.playbook)
+	}
+	s.parsed = parsed
+	return playbooks, nil
+}
+
+// invalidate drops the cached parses of the given files, and of everything
+// below them for directories, so the next load parses them again even if
+// their size and modification time look unchanged.
+func (l *PlaybookLibrary) invalidate(paths []string) {
+	for _, src := range l.sources {
+		src.parsedMu.Lock()
+		for cached := range src.parsed {
+			for _, p := range paths {
+				if cached == p || strings.HasPrefix(cached, p+string(filepath.Separator)) {
+					delete(src.parsed, cached)
+					break
+				}
+			}
+		}
+		src.parsedMu.Unlock()
+	}
+}
+
+// Sync fetches every git source once. Failures are returned together; the
+// other sources are still fetched.
+func (l *PlaybookLibrary) Sync(ctx context.Context) error {
+	var errs []error
+	for _, src := range l.sources {
+		if !src.isGit() {
+			continue
+		}
+		if _, err := src.sync(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("playbook source %s: %w", src.cfg.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dirs returns the roots of the local sources, which are watched for changes.
+func (l *PlaybookLibrary) dirs() []string {
+	var dirs []string
+	for _, src := range l.sources {
+		if !src.isGit() {
+			dirs = append(dirs, src.root)
+		}
+	}
+	return dirs
+}
+
+func (l *PlaybookLibrary) gitSources() []*playbookSource {
+	var sources []*playbookSource
+	for _, src := range l.sources {
+		if src.isGit() {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+func (s *playbookSource) isGit() bool {
+	return s.cfg.Type == config.PlaybookSourceGit
+}
+
+// sync fetches the configured ref into the cache directory and checks it
+// out, reporting whether the checked-out commit changed.
+func (s *playbookSource) sync(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	dir := s.cfg.CacheDir
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return false, fmt.Errorf("creating cache directory: %w", err)
+		}
+		if _, err := runGit(ctx, dir, "init", "--quiet"); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "--force", "--depth=1", s.cfg.URL, s.cfg.Ref); err != nil {
+		return false, fmt.Errorf("fetching %s from %s: %w", s.cfg.Ref, redactURL(s.cfg.URL), err)
+	}
+	commit, err := runGit(ctx, dir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if commit == s.commit {
+		return false, nil
+	}
+	if _, err := runGit(ctx, dir, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return false, err
+	}
+	slog.Info("playbook source updated", "source", s.cfg.Name, "ref", s.cfg.Ref, "commit", commit, "previous", s.commit)
+	s.commit = commit
+	return true, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Fail instead of waiting for credentials on a terminal.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// redactURL hides credentials embedded in a repository URL for logging.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,63 @@
+package agent
+
+import "testing"
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		name            string
+		raw             string
+		wantFrontmatter string
+		wantBody        string
+		wantErr         bool
+	}{
+		{
+			name:            "frontmatter and body",
+			raw:             "---\ndescription: Checkout latency\n---\n# Steps\n",
+			wantFrontmatter: "description: Checkout latency",
+			wantBody:        "# Steps",
+		},
+		{
+			name:     "no frontmatter",
+			raw:      "# Steps\n\nCheck the dashboard.",
+			wantBody: "# Steps\n\nCheck the dashboard.",
+		},
+		{
+			name:            "dashes inside a YAML value",
+			raw:             "---\ndescription: Errors --- then timeouts\n---\nBody",
+			wantFrontmatter: "description: Errors --- then timeouts",
+			wantBody:        "Body",
+		},
+		{
+			name:            "rule in the body",
+			raw:             "---\ndescription: x\n---\nBefore\n\n---\n\nAfter",
+			wantFrontmatter: "description: x",
+			wantBody:        "Before\n\n---\n\nAfter",
+		},
+		{
+			name:            "CRLF line endings",
+			raw:             "---\r\ndescription: x\r\n---\r\nBody\r\n",
+			wantFrontmatter: "description: x",
+			wantBody:        "Body",
+		},
+		{
+			name:    "unterminated",
+			raw:     "---\ndescription: x ---\nBody",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontmatter, body, err := splitFrontmatter(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if frontmatter != tt.wantFrontmatter {
+				t.Errorf("frontmatter = %q, want %q", frontmatter, tt.wantFrontmatter)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+)
+
+type GetPlaybookArgs struct {
+	Name    string `json:"name" jsonschema:"Name of the playbook to load"`
+	Section string `json:"section,omitempty" jsonschema:"Optional section heading to load only that section, as listed in the playbook index; omit to load the whole playbook"`
+}
+
+type GetPlaybookResult struct {
+	Content string `json:"content"`
+}
+
+type ListPlaybookSectionsArgs struct {
+	Name string `json:"name" jsonschema:"Name of the playbook"`
+}
+
+type ListPlaybookSectionsResult struct {
+	Sections []string `json:"sections"`
+}
+
+type SearchPlaybooksArgs struct {
+	Query string `json:"query" jsonschema:"Words describing the problem, e.g. symptoms, services or error messages"`
+	Limit int    `json:"limit,omitempty" jsonschema:"Maximum number of results (default 5)"`
+}
+
+type SearchPlaybooksResult struct {
+	Results []SearchResult `json:"results"`
+}
+
+const (
+	defaultSearchResults = 5
+	maxSearchResults     = 20
+)
+
+// newPlaybookTools creates the coordinator's tools for reading playbooks:
+// get_playbook, for a whole playbook or one section, list_playbook_sections
+// and search_playbooks.
+func newPlaybookTools(store *playbookStore) ([]tool.Tool, error) {
+	getPlaybookTool, err := functiontool.New(
+		functiontool.Config{
+			Name: "get_playbook",
+			Description: "Loads a playbook by name. Use this to get detailed investigation steps. " +
+				"Pass a section heading to load only that section when the request concerns one area of a large playbook.",
+		},
+		func(ctx tool.Context, args GetPlaybookArgs) (GetPlaybookResult, error) {
+			pb, err := lookupPlaybook(ctx, store, args.Name)
+			if err != nil {
+				return GetPlaybookResult{}, err
+			}
+			if args.Section == "" {
+				slog.Info("playbook loaded by coordinator", "name", args.Name, "size_bytes", len(pb.Content))
+				return GetPlaybookResult{Content: pb.Content}, nil
+			}
+
+			section, ok := pb.Section(args.Section)
+			if !ok {
+				slog.Warn("playbook section not found", "name", args.Name, "section", args.Section)
+				return GetPlaybookResult{}, fmt.Errorf("playbook %q has no section %q; its sections are: %s",
+					args.Name, args.Section, strings.Join(pb.SectionHeadings(), "; "))
+			}
+			slog.Info("playbook section loaded by coordinator", "name", args.Name, "section", section.Heading, "size_bytes", len(section.Content))
+			return GetPlaybookResult{Content: section.Content}, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating get_playbook tool: %w", err)
+	}
+
+	listSectionsTool, err := functiontool.New(
+		functiontool.Config{
+			Name:        "list_playbook_sections",
+			Description: "Lists the section headings of a playbook, for loading single sections with get_playbook.",
+		},
+		func(ctx tool.Context, args ListPlaybookSectionsArgs) (ListPlaybookSectionsResult, error) {
+			pb, err := lookupPlaybook(ctx, store, args.Name)
+			if err != nil {
+				return ListPlaybookSectionsResult{}, err
+			}
+			return ListPlaybookSectionsResult{Sections: pb.SectionHeadings()}, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating list_playbook_sections tool: %w", err)
+	}
+
+	searchTool, err := functiontool.New(
+		functiontool.Config{
+			Name: "search_playbooks",
+			Description: "Searches the names, tags, headings and text of all playbooks and returns the best matching sections with a snippet. " +
+				"Use it when no playbook in the index clearly matches the request.",
+		},
+		func(ctx tool.Context, args SearchPlaybooksArgs) (SearchPlaybooksResult, error) {
+			limit := min(cmp.Or(args.Limit, defaultSearchResults), maxSearchResults)
+			results := store.search(args.Query, limit, func(name string) bool {
+				return playbookAllowed(ctx, name)
+			})
+			slog.Info("playbooks searched by coordinator", "query", args.Query, "results", len(results))
+			return SearchPlaybooksResult{Results: results}, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating search_playbooks tool: %w", err)
+	}
+
+	return []tool.Tool{getPlaybookTool, listSectionsTool, searchTool}, nil
+}
+
+func lookupPlaybook(ctx tool.Context, store *playbookStore, name string) (Playbook, error) {
+	if !playbookAllowed(ctx, name) {
+		slog.Warn("playbook not allowed for request", "name", name)
+		return Playbook{}, fmt.Errorf("playbook %q is not available for this request", name)
+	}
+	pb, ok := store.get(name)
+	if !ok {
+		slog.Warn("playbook not found", "name", name)
+		return Playbook{}, fmt.Errorf("playbook %q not found", name)
+	}
+	return pb, nil
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// playbookReloadDelay coalesces the burst of file events an editor or a
+// ConfigMap update produces into one reload.
+const playbookReloadDelay = 500 * time.Millisecond
+
+// playbookSet is one loaded, immutable generation of playbooks.
+type playbookSet struct {
+	playbooks []Playbook
+	byName    map[string]Playbook
+	index     string
+	search    *searchIndex
+}
+
+func newPlaybookSet(playbooks []Playbook) *playbookSet {
+	byName := make(map[string]Playbook, len(playbooks))
+	for _, pb := range playbooks {
+		byName[pb.Name] = pb
+	}
+	return &playbookSet{
+		playbooks: playbooks,
+		byName:    byName,
+		index:     BuildPlaybookIndex(playbooks),
+		search:    newSearchIndex(playbooks),
+	}
+}
+
+// playbookStore holds the live playbook set. Readers always see a complete
+// set; a reload replaces it in one step.
+type playbookStore struct {
+	current atomic.Pointer[playbookSet]
+}
+
+func newPlaybookStore(playbooks []Playbook) *playbookStore {
+	s := &playbookStore{}
+	s.current.Store(newPlaybookSet(playbooks))
+	return s
+}
+
+func (s *playbookStore) get(name string) (Playbook, bool) {
+	pb, ok := s.current.Load().byName[name]
+	return pb, ok
+}
+
+func (s *playbookStore) index() string {
+	return s.current.Load().index
+}
+
+func (s *playbookStore) search(query string, limit int, allowed func(string) bool) []SearchResult {
+	return s.current.Load().search.search(query, limit, allowed)
+}
+
+func (s *playbookStore) swap(playbooks []Playbook) {
+	s.current.Store(newPlaybookSet(playbooks))
+}
+
+// ReloadPlaybooks loads the library's playbooks and makes them live. Only
+// files that changed since the last load are parsed again. If any playbook
+// fails to load, the current set stays live and the error is returned.
+func (s *Service) ReloadPlaybooks(lib *PlaybookLibrary) error {
+	playbooks, err := lib.Load()
+	if err != nil {
+		return err
+	}
+	s.playbooks.swap(playbooks)
+	slog.Info("playbooks reloaded", "count", len(playbooks))
+	return nil
+}
+
+// WatchPlaybooks reloads the playbooks whenever a file in a local source
+// changes or a git source moves to a new commit, until ctx is cancelled. The
+// coordinator's playbook index is rebuilt on reload, so new sessions and
+// later turns see the change without a restart. If the local sources cannot
+// be watched, git sources are still polled.
+func (s *Service) WatchPlaybooks(ctx context.Context, lib *PlaybookLibrary) {
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	watcher, err := newPlaybookWatcher(lib.dirs())
+	if err != nil {
+		slog.Error("local playbook hot-reload disabled", "error", err)
+	} else {
+		events, watchErrs = watcher.Events, watcher.Errors
+	}
+
+	updated := make(chan struct{}, 1)
+	for _, src := range lib.gitSources() {
+		go pollGitSource(ctx, src, updated)
+	}
+
+	go func() {
+		if watcher != nil {
+			defer watcher.Close()
+		}
+		reload := time.NewTimer(0)
+		<-reload.C
+		// Files touched since the last reload; events are debounced by the
+		// reload timer.
+		var touched []string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				slog.Debug("playbook change detected", "file", event.Name, "op", event.Op.String())
+				touched = append(touched, event.Name)
+				if event.Op.Has(fsnotify.Create) {
+					// Watch new subdirectories; files are not affected.
+					watchTree(watcher, event.Name)
+				}
+				reload.Reset(playbookReloadDelay)
+			case err, ok := <-watchErrs:
+				if !ok {
+					return
+				}
+				slog.Error("playbook watcher error", "error", err)
+			case <-updated:
+				reload.Reset(0)
+			case <-reload.C:
+				lib.invalidate(touched)
+				touched = nil
+				if err := s.ReloadPlaybooks(lib); err != nil {
+					slog.Error("playbook reload rejected, keeping the previous playbooks", "error", err)
+				}
+			}
+		}
+	}()
+
+	slog.Info("watching playbooks for changes", "dirs", lib.dirs(), "file_watcher", watcher != nil, "git_sources", len(lib.gitSources()))
+}
+
+// newPlaybookWatcher watches dirs and their subdirectories.
+func newPlaybookWatcher(dirs []string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating playbook watcher: %w", err)
+	}
+	for _, dir := range dirs {
+		if err := watchTree(watcher, dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watching playbooks directory: %w", err)
+		}
+	}
+	return watcher, nil
+}
+
+// watchTree adds dir and its subdirectories to the watcher; fsnotify does
+// not watch recursively. Hidden directories are skipped.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != dir {
+			return filepath.SkipDir
+		}
+		return watcher.Add(p)
+	})
+}
+
+// pollGitSource fetches a git source every interval and signals updated when
+// it moves to a new commit.
+func pollGitSource(ctx context.Context, src *playbookSource, updated chan<- struct{}) {
+	ticker := time.NewTicker(src.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := src.sync(ctx)
+		if err != nil {
+			slog.Error("failed to update playbook source, keeping the current checkout", "source", src.cfg.Name, "error", err)
+			continue
+		}
+		if changed {
+			select {
+			case updated <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/adk/session"
+)
+
+// errSessionExpired is returned for sessions whose keys are gone from Redis.
+var errSessionExpired = errors.New("session not found")
+
+// redisSessionService keeps sessions in Redis and serves them through an
+// in-memory cache. Sessions missing from the cache (e.g. after a restart) are
+// rebuilt by replaying their stored events into the in-memory service, so the
+// runner always works with regular in-memory sessions. Cached sessions that
+// have not been used for cacheIdle are dropped from the cache; Redis stays the
+// source of truth.
+//
+// Operations on one session are serialised; different sessions proceed in
+// parallel. No lock is held across calls to other sessions.
+type redisSessionService struct {
+	client    *redis.Client
+	prefix    string
+	ttl       time.Duration
+	cacheIdle time.Duration
+	cache     session.Service
+	locks     *sessionLocks
+
+	mu        sync.Mutex // guards lastUsed and lastSweep
+	lastUsed  map[cacheKey]time.Time
+	lastSweep time.Time
+}
+
+type cacheKey struct {
+	app, userID, sessionID string
+}
+
+// defaultCacheIdle bounds how long an unused session stays in memory.
+const defaultCacheIdle = 30 * time.Minute
+
+type redisSessionMeta struct {
+	State     map[string]any `json:"state"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+func newRedisSessionService(client *redis.Client, prefix string, ttl time.Duration) *redisSessionService {
+	cacheIdle := defaultCacheIdle
+	if ttl > 0 && ttl < cacheIdle {
+		cacheIdle = ttl
+	}
+	return &redisSessionService{
+		client:    client,
+		prefix:    prefix,
+		ttl:       ttl,
+		cacheIdle: cacheIdle,
+		cache:     session.InMemoryService(),
+		locks:     newSessionLocks(),
+		lastUsed:  make(map[cacheKey]time.Time),
+	}
+}
+
+// appendEventScript appends an event to a session that still exists and
+// refreshes the session's expiry, in one step. It returns 0 if the session
+// expired or was deleted.
+//
+// KEYS: meta, events, index. ARGV: event JSON, TTL in milliseconds (0 for none).
+var appendEventScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("RPUSH", KEYS[2], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	for _, key in ipairs(KEYS) do
+		redis.call("PEXPIRE", key, ttl)
+	end
+end
+return 1
+`)
+
+func (s *redisSessionService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
+	resp, err := s.cache.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{req.AppName, req.UserID, resp.Session.ID()}
+	unlock := s.locks.lock(key)
+	defer unlock()
+
+	meta, err := json.Marshal(redisSessionMeta{State: req.State, CreatedAt: time.Now()})
+	if err != nil {
+		return nil, fmt.Errorf("encoding session: %w", err)
+	}
+
+	sessionID := resp.Session.ID()
+	indexKey := s.indexKey(req.AppName, req.UserID)
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, s.metaKey(req.AppName, req.UserID, sessionID), meta, s.ttl)
+	pipe.Del(ctx, s.eventsKey(req.AppName, req.UserID, sessionID))
+	pipe.SAdd(ctx, indexKey, sessionID)
+	if s.ttl > 0 {
+		pipe.Expire(ctx, indexKey, s.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("storing session: %w", err)
+	}
+	s.touch(ctx, key)
+	return resp, nil
+}
+
+func (s *redisSessionService) Get(ctx context.Context, req *session.GetRequest) (*session.GetResponse, error) {
+	key := cacheKey{req.AppName, req.UserID, req.SessionID}
+	unlock := s.locks.lock(key)
+	defer unlock()
+
+	if resp, err := s.cache.Get(ctx, req); err == nil {
+		s.touch(ctx, key)
+		return resp, nil
+	}
+
+	if err := s.restore(ctx, req.AppName, req.UserID, req.SessionID); err != nil {
+		return nil, err
+	}
+	s.touch(ctx, key)
+	return s.cache.Get(ctx, req)
+}
+
+func (s *redisSessionService) List(ctx context.Context, req *session.ListRequest) (*session.ListResponse, error) {
+	if req.UserID == "" {
+		return nil, fmt.Errorf("user_id is required for redis session store")
+	}
+
+	ids, err := s.client.SMembers(ctx, s.indexKey(req.AppName, req.UserID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+
+	var sessions []session.Session
+	for _, id := range ids {
+		resp, err := s.Get(ctx, &session.GetRequest{AppName: req.AppName, UserID: req.UserID, SessionID: id})
+		if errors.Is(err, errSessionExpired) {
+			// The session keys expired; drop it from the index too.
+			s.client.SRem(ctx, s.indexKey(req.AppName, req.UserID), id)
+			continue
+		}
+		if err != nil {
+			slog.Warn("skipping unreadable session", "session", id, "error", err)
+			continue
+		}
+		sessions = append(sessions, resp.Session)
+	}
+	return &session.ListResponse{Sessions: sessions}, nil
+}
+
+func (s *redisSessionService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+	key := cacheKey{req.AppName, req.UserID, req.SessionID}
+	unlock := s.locks.lock(key)
+	defer unlock()
+
+	if s.cached(key) {
+		if err := s.cache.Delete(ctx, req); err != nil {
+			return err
+		}
+		s.forget(key)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, s.metaKey(req.AppName, req.UserID, req.SessionID), s.eventsKey(req.AppName, req.UserID, req.SessionID))
+	pipe.SRem(ctx, s.indexKey(req.AppName, req.UserID), req.SessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	return nil
+}
+
+func (s *redisSessionService) AppendEvent(ctx context.Context, sess session.Session, event *session.Event) error {
+	key := cacheKey{sess.AppName(), sess.UserID(), sess.ID()}
+	unlock := s.locks.lock(key)
+	defer unlock()
+
+	if !s.cached(key) {
+		// Evicted while the caller still held it; load it back first.
+		if err := s.restore(ctx, key.app, key.userID, key.sessionID); err != nil {
+			return err
+		}
+	}
+	s.touch(ctx, key)
+	if err := s.cache.AppendEvent(ctx, sess, event); err != nil {
+		return err
+	}
+	if event.Partial {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	keys := []string{
+		s.metaKey(key.app, key.userID, key.sessionID),
+		s.eventsKey(key.app, key.userID, key.sessionID),
+		s.indexKey(key.app, key.userID),
+	}
+	stored, err := appendEventScript.Run(ctx, s.client, keys, data, s.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("storing event: %w", err)
+	}
+	if stored == 0 {
+		// The session expired or was deleted elsewhere; do not keep a copy
+		// that Redis no longer has.
+		if err := s.cache.Delete(ctx, &session.DeleteRequest{AppName: key.app, UserID: key.userID, SessionID: key.sessionID}); err != nil {
+			slog.Warn("failed to evict cached session", "session", key.sessionID, "error", err)
+		}
+		s.forget(key)
+		return fmt.Errorf("session %s: %w", key.sessionID, errSessionExpired)
+	}
+	return nil
+}
+
+// restore loads a session from Redis into the in-memory cache. Callers must
+// hold the session's lock.
+func (s *redisSessionService) restore(ctx context.Context, app, userID, sessionID string) error {
+	rawMeta, err := s.client.Get(ctx, s.metaKey(app, userID, sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("session %s: %w", sessionID, errSessionExpired)
+	}
+	if err != nil {
+		return fmt.Errorf("loading session: %w", err)
+	}
+
+	var meta redisSessionMeta
+	if err := json.Unmarshal(rawMeta, &meta); err != nil {
+		return fmt.Errorf("decoding session: %w", err)
+	}
+
+	rawEvents, err := s.client.LRange(ctx, s.eventsKey(app, userID, sessionID), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("loading session events: %w", err)
+	}
+
+	created, err := s.cache.Create(ctx, &session.CreateRequest{
+		AppName:   app,
+		UserID:    userID,
+		SessionID: sessionID,
+		State:     meta.State,
+	})
+	if err != nil {
+		return fmt.Errorf("restoring session: %w", err)
+	}
+
+	for _, raw := range rawEvents {
+		var event session.Event
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			return fmt.Errorf("decoding session event: %w", err)
+		}
+		if err := s.cache.AppendEvent(ctx, created.Session, &event); err != nil {
+			return fmt.Errorf("replaying session event: %w", err)
+		}
+	}
+
+	slog.Info("session restored from redis", "user", userID, "session", sessionID, "events", len(rawEvents))
+	return nil
+}
+
+// touch marks a cached session as used and, at most once per minute, evicts
+// sessions that have been idle for longer than cacheIdle. Sessions with an
+// operation in progress are left for the next sweep. Callers must hold the
+// session's lock.
+func (s *redisSessionService) touch(ctx context.Context, key cacheKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastUsed[key] = now
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, used := range s.lastUsed {
+		if now.Sub(used) < s.cacheIdle {
+			continue
+		}
+		unlock, ok := s.locks.tryLock(k)
+		if !ok {
+			continue
+		}
+		err := s.cache.Delete(ctx, &session.DeleteRequest{AppName: k.app, UserID: k.userID, SessionID: k.sessionID})
+		if err != nil {
+			slog.Warn("failed to evict cached session", "session", k.sessionID, "error", err)
+		}
+		delete(s.lastUsed, k)
+		unlock()
+	}
+}
+
+func (s *redisSessionService) cached(key cacheKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.lastUsed[key]
+	return ok
+}
+
+func (s *redisSessionService) forget(key cacheKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.lastUsed, key)
+}
+
+func (s *redisSessionService) metaKey(app, userID, sessionID string) string {
+	return fmt.Sprintf("%ssession:%s:%s:%s", s.prefix, app, userID, sessionID)
+}
+
+func (s *redisSessionService) eventsKey(app, userID, sessionID string) string {
+	return fmt.Sprintf("%sevents:%s:%s:%s", s.prefix, app, userID, sessionID)
+}
+
+func (s *redisSessionService) indexKey(app, userID string) string {
+	return fmt.Sprintf("%ssessions:%s:%s", s.prefix, app, userID)
+}
+
+// sessionLocks hands out one lock per session, created on demand and dropped
+// when no operation holds or waits for it.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[cacheKey]*sessionLock
+}
+
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newSessionLocks() *sessionLocks {
+	return &sessionLocks{locks: make(map[cacheKey]*sessionLock)}
+}
+
+// lock blocks until the session's lock is held and returns its release.
+func (l *sessionLocks) lock(key cacheKey) (unlock func()) {
+	l.mu.Lock()
+	sl, ok := l.locks[key]
+	if !ok {
+		sl = &sessionLock{}
+		l.locks[key] = sl
+	}
+	sl.refs++
+	l.mu.Unlock()
+
+	sl.Lock()
+	return func() { l.release(key, sl) }
+}
+
+// tryLock takes the session's lock only if no operation holds or waits for it.
+func (l *sessionLocks) tryLock(key cacheKey) (unlock func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, busy := l.locks[key]; busy {
+		return nil, false
+	}
+	sl := &sessionLock{refs: 1}
+	sl.Lock()
+	l.locks[key] = sl
+	return func() { l.release(key, sl) }, true
+}
+
+func (l *sessionLocks) release(key cacheKey, sl *sessionLock) {
+	sl.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sl.refs--; sl.refs == 0 {
+		delete(l.locks, key)
+	}
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestRedisSessionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestRedis(t)
+	svc := newRedisSessionService(client, "test:", time.Hour)
+
+	created, err := svc.Create(ctx, &session.CreateRequest{
+		AppName:   "incidently",
+		UserID:    "U1",
+		SessionID: "C1:1700000000.000100",
+		State:     map[string]any{"channel": "C1", "labels": map[string]any{"team": "payments"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	question := session.NewEvent("inv-1")
+	question.Author = "user"
+	question.LLMResponse = model.LLMResponse{Content: genai.NewContentFromText("why is checkout slow?", genai.RoleUser)}
+	question.Actions.StateDelta["step"] = "triage"
+
+	call := session.NewEvent("inv-1")
+	call.Author = "coordinator"
+	call.LLMResponse = model.LLMResponse{Content: &genai.Content{
+		Role:  genai.RoleModel,
+		Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "call-1", Name: "get_playbook", Args: map[string]any{"name": "latency"}}}},
+	}}
+	call.LongRunningToolIDs = []string{"call-1"}
+	call.Actions.StateDelta["attempts"] = 2
+
+	partial := session.NewEvent("inv-1")
+	partial.Author = "coordinator"
+	partial.LLMResponse = model.LLMResponse{Content: genai.NewContentFromText("Look", genai.RoleModel), Partial: true}
+
+	for _, e := range []*session.Event{question, call, partial} {
+		if err := svc.AppendEvent(ctx, created.Session, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new service has an empty cache, as after a restart.
+	restored, err := newRedisSessionService(client, "test:", time.Hour).Get(ctx, &session.GetRequest{
+		AppName:   "incidently",
+		UserID:    "U1",
+		SessionID: "C1:1700000000.000100",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantState := map[string]any{
+		"channel":  "C1",
+		"labels":   map[string]any{"team": "payments"},
+		"step":     "triage",
+		"attempts": float64(2), // JSON numbers come back as float64
+	}
+	gotState := make(map[string]any)
+	for k, v := range restored.Session.State().All() {
+		gotState[k] = v
+	}
+	if !reflect.DeepEqual(gotState, wantState) {
+		t.Errorf("state = %v, want %v", gotState, wantState)
+	}
+
+	events := restored.Session.Events()
+	if events.Len() != 2 {
+		t.Fatalf("got %d events, want 2 (partial events are not stored)", events.Len())
+	}
+	for i, want := range []*session.Event{question, call} {
+		got := events.At(i)
+		if got.ID != want.ID || got.Author != want.Author || got.InvocationID != want.InvocationID {
+			t.Errorf("event %d = %s by %s in %s, want %s by %s in %s", i, got.ID, got.Author, got.InvocationID, want.ID, want.Author, want.InvocationID)
+		}
+		if !reflect.DeepEqual(got.LongRunningToolIDs, want.LongRunningToolIDs) {
+			t.Errorf("event %d long-running tool IDs = %v, want %v", i, got.LongRunningToolIDs, want.LongRunningToolIDs)
+		}
+		if len(got.Actions.StateDelta) != len(want.Actions.StateDelta) {
+			t.Errorf("event %d state delta = %v, want %v", i, got.Actions.StateDelta, want.Actions.StateDelta)
+		}
+		if got.Content.Parts[0].Text != want.Content.Parts[0].Text {
+			t.Errorf("event %d text = %q, want %q", i, got.Content.Parts[0].Text, want.Content.Parts[0].Text)
+		}
+	}
+	fc := events.At(1).Content.Parts[0].FunctionCall
+	if fc == nil || fc.ID != "call-1" || fc.Name != "get_playbook" || fc.Args["name"] != "latency" {
+		t.Errorf("function call = %+v, want get_playbook(name=latency) with ID call-1", fc)
+	}
+}
+
+func TestRedisSessionTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, client := newTestRedis(t)
+	const ttl = 10 * time.Minute
+	svc := newRedisSessionService(client, "test:", ttl)
+
+	created, err := svc.Create(ctx, &session.CreateRequest{AppName: "incidently", UserID: "U1", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{
+		svc.metaKey("incidently", "U1", "s1"),
+		svc.eventsKey("incidently", "U1", "s1"),
+		svc.indexKey("incidently", "U1"),
+	}
+
+	mr.FastForward(6 * time.Minute)
+	event := session.NewEvent("inv-1")
+	event.Author = "user"
+	if err := svc.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if got := mr.TTL(key); got != ttl {
+			t.Errorf("TTL of %s after an event = %v, want it refreshed to %v", key, got, ttl)
+		}
+	}
+
+	// Past the original expiry, the session is still there.
+	mr.FastForward(6 * time.Minute)
+	if !mr.Exists(keys[0]) {
+		t.Fatal("session expired although an event refreshed it")
+	}
+
+	mr.FastForward(ttl)
+	_, err = newRedisSessionService(client, "test:", ttl).Get(ctx, &session.GetRequest{AppName: "incidently", UserID: "U1", SessionID: "s1"})
+	if !errors.Is(err, errSessionExpired) {
+		t.Errorf("Get after expiry: err = %v, want errSessionExpired", err)
+	}
+
+	// Appending to the expired session must not leave orphaned events.
+	if err := svc.AppendEvent(ctx, created.Session, session.NewEvent("inv-2")); !errors.Is(err, errSessionExpired) {
+		t.Errorf("AppendEvent after expiry: err = %v, want errSessionExpired", err)
+	}
+	if mr.Exists(keys[1]) {
+		t.Error("events stored for an expired session")
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/glebarez/sqlite"
+	"github.com/illenko/incidently/internal/config"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/session/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const appName = "incidently"
+
+// newSessionService builds the session backend selected in config. The returned
+// closer releases the underlying connection and is nil for the in-memory backend.
+func newSessionService(ctx context.Context, cfg config.SessionConfig) (session.Service, io.Closer, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		slog.Info("using in-memory session store")
+		return session.InMemoryService(), nil, nil
+
+	case "sqlite":
+		slog.Info("using sqlite session store", "path", cfg.Path)
+		if dir := filepath.Dir(cfg.Path); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, nil, fmt.Errorf("creating session store directory: %w", err)
+			}
+		}
+		gormCfg := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+		db, err := gorm.Open(sqlite.Open(cfg.Path), gormCfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening sqlite session store: %w", err)
+		}
+		// The session service keeps its gorm handle private, so open the
+		// connection here and hand it over to be able to close it.
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening sqlite session store: %w", err)
+		}
+		svc, err := database.NewSessionService(&sqlite.Dialector{Conn: sqlDB}, gormCfg)
+		if err != nil {
+			sqlDB.Close()
+			return nil, nil, fmt.Errorf("opening sqlite session store: %w", err)
+		}
+		if err := database.AutoMigrate(svc); err != nil {
+			sqlDB.Close()
+			return nil, nil, fmt.Errorf("migrating sqlite session store: %w", err)
+		}
+		return svc, sqlDB, nil
+
+	case "redis":
+		slog.Info("using redis session store", "addr", cfg.Redis.Addr, "db", cfg.Redis.DB)
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		if err := client.Ping(ctx).Err(); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("connecting to redis: %w", err)
+		}
+		prefix := cfg.Redis.KeyPrefix
+		if prefix == "" {
+			prefix = appName + ":"
+		}
+		return newRedisSessionService(client, prefix, cfg.Redis.TTL), client, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported session backend %q", cfg.Backend)
+	}
+}
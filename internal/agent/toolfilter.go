@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/illenko/incidently/internal/config"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/tool"
+)
+
+// toolFilter restricts a specialist to individual MCP tools. Patterns are
+// globs matched against the bare tool name, or against "server/tool" when the
+// pattern contains a slash.
+type toolFilter struct {
+	include []string
+	exclude []string
+}
+
+func newToolFilter(cfg config.AgentConfig) toolFilter {
+	return toolFilter{include: cfg.IncludeTools, exclude: cfg.ExcludeTools}
+}
+
+func (f toolFilter) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+func (f toolFilter) allows(server, name string) bool {
+	if len(f.include) > 0 && !matchesAny(f.include, server, name) {
+		return false
+	}
+	return !matchesAny(f.exclude, server, name)
+}
+
+// apply wraps a server's toolset so only allowed tools are exposed.
+func (f toolFilter) apply(server string, ts tool.Toolset) tool.Toolset {
+	if f.empty() {
+		return ts
+	}
+	return tool.FilterToolset(ts, func(_ agent.ReadonlyContext, t tool.Tool) bool {
+		return f.allows(server, t.Name())
+	})
+}
+
+// validate checks every pattern against the discovered catalogs of the
+// agent's servers. Include patterns that match nothing are errors; exclude
+// patterns that match nothing are returned as warnings. Servers without a
+// catalog (unavailable at startup) are skipped.
+func (f toolFilter) validate(catalogs map[string][]string) (warnings []string, err error) {
+	var errs []string
+	check := func(pattern string, isInclude bool) {
+		matched, checked := false, false
+		for server, tools := range catalogs {
+			if srv, _, ok := strings.Cut(pattern, "/"); ok && srv != server {
+				continue
+			}
+			if tools == nil {
+				continue
+			}
+			checked = true
+			for _, name := range tools {
+				if matchPattern(pattern, server, name) {
+					matched = true
+				}
+			}
+		}
+		if !checked || matched {
+			return
+		}
+		if isInclude {
+			errs = append(errs, fmt.Sprintf("include pattern %q matches no tools", pattern))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("exclude pattern %q matches no tools", pattern))
+		}
+	}
+
+	for _, p := range f.include {
+		check(p, true)
+	}
+	for _, p := range f.exclude {
+		check(p, false)
+	}
+
+	if len(errs) > 0 {
+		return warnings, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return warnings, nil
+}
+
+func matchesAny(patterns []string, server, name string) bool {
+	for _, p := range patterns {
+		if matchPattern(p, server, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, server, name string) bool {
+	subject := name
+	if strings.Contains(pattern, "/") {
+		subject = server + "/" + name
+	}
+	ok, _ := path.Match(pattern, subject)
+	return ok
+}
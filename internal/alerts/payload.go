@@ -0,0 +1,131 @@
+package alerts
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook is an Alertmanager webhook notification. Grafana alerting sends the
+// same shape with a few extra fields, which are included here.
+type Webhook struct {
+	Receiver          string            `json:"receiver"`
+	Status            string            `json:"status"`
+	Alerts            []Alert           `json:"alerts"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	GroupKey          string            `json:"groupKey"`
+
+	// Grafana only.
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Alert is a single alert within a webhook notification.
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+
+	// Grafana only.
+	DashboardURL string `json:"dashboardURL"`
+	PanelURL     string `json:"panelURL"`
+	ValueString  string `json:"valueString"`
+}
+
+const statusFiring = "firing"
+
+// labels returns the labels that describe the whole group: the common labels,
+// or the first alert's labels when the sender does not provide them.
+func (w *Webhook) labels() map[string]string {
+	if len(w.CommonLabels) > 0 || len(w.Alerts) == 0 {
+		return w.CommonLabels
+	}
+	return w.Alerts[0].Labels
+}
+
+func (w *Webhook) annotation(name string) string {
+	if v := w.CommonAnnotations[name]; v != "" {
+		return v
+	}
+	for _, a := range w.Alerts {
+		if v := a.Annotations[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (w *Webhook) name() string {
+	return cmp.Or(w.labels()["alertname"], w.GroupLabels["alertname"], w.Title, "alert")
+}
+
+// groupKey identifies the alert group across notifications.
+func (w *Webhook) groupKey() string {
+	if w.GroupKey != "" {
+		return w.GroupKey
+	}
+	labels := w.GroupLabels
+	if len(labels) == 0 {
+		labels = w.labels()
+	}
+	return w.Receiver + ":" + formatLabels(labels)
+}
+
+func (w *Webhook) count(status string) int {
+	n := 0
+	for _, a := range w.Alerts {
+		if a.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *Webhook) startedAt() time.Time {
+	var first time.Time
+	for _, a := range w.Alerts {
+		if !a.StartsAt.IsZero() && (first.IsZero() || a.StartsAt.Before(first)) {
+			first = a.StartsAt
+		}
+	}
+	return first
+}
+
+// links returns Markdown links to the alert source and dashboard.
+func (w *Webhook) links() string {
+	var links []string
+	for _, a := range w.Alerts {
+		if a.GeneratorURL != "" {
+			links = append(links, fmt.Sprintf("[Source](%s)", a.GeneratorURL))
+		}
+		if a.DashboardURL != "" {
+			links = append(links, fmt.Sprintf("[Dashboard](%s)", a.DashboardURL))
+		}
+		if a.PanelURL != "" {
+			links = append(links, fmt.Sprintf("[Panel](%s)", a.PanelURL))
+		}
+		if len(links) > 0 {
+			break
+		}
+	}
+	return strings.Join(links, " · ")
+}
+
+// formatLabels renders labels as sorted key=value pairs.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ", ")
+}
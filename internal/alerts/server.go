@@ -0,0 +1,310 @@
+// Package alerts receives Alertmanager and Grafana alert webhooks and starts
+// an investigation in Slack for each new alert group.
+package alerts
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/config"
+	islack "github.com/illenko/incidently/internal/slack"
+)
+
+const (
+	defaultGroupWindow = 30 * time.Minute
+	maxPayloadBytes    = 1 << 20
+	shutdownTimeout    = 5 * time.Second
+	alertSender        = "alert webhook"
+)
+
+// Server turns alert webhooks into Slack threads with an investigation.
+type Server struct {
+	cfg config.AlertsConfig
+	gw  *islack.Gateway
+
+	mu     sync.Mutex // guards groups; not held during Slack calls
+	groups map[string]*alertGroup
+}
+
+// alertGroup is an alert group with an investigation thread. Its fields are
+// guarded by mu, which is held while the group's Slack messages are posted,
+// so notifications for one group are handled in order without holding up
+// the others.
+type alertGroup struct {
+	mu        sync.Mutex
+	removed   bool // swept from Server.groups
+	name      string
+	channel   string
+	playbooks []string
+	ts        string // header message, also the thread; empty until posted
+	submitted bool   // the investigation was queued
+	started   time.Time
+	lastFired time.Time
+	fired     int
+	resolved  bool
+}
+
+func NewServer(cfg config.AlertsConfig, gw *islack.Gateway) *Server {
+	return &Server{
+		cfg:    cfg,
+		gw:     gw,
+		groups: make(map[string]*alertGroup),
+	}
+}
+
+// Run serves webhooks until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhooks/alertmanager", s.handleWebhook)
+	mux.HandleFunc("POST /webhooks/grafana", s.handleWebhook)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := &http.Server{
+		Addr:              s.cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("alert webhook server listening", "address", s.cfg.Listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving alert webhooks: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var hook Webhook
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPayloadBytes)).Decode(&hook); err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.handle(&hook); err != nil {
+		slog.Error("failed to handle alert", "error", err, "alert", hook.name(), "path", r.URL.Path)
+		// A non-2xx status makes Alertmanager and Grafana retry.
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.cfg.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+// handle starts an investigation for a newly firing group. Repeats less than
+// a group window after the group last fired only update the group's header
+// message, so neither a flapping nor a continuously firing alert starts a new
+// investigation each time it is notified; only a group that has been quiet
+// for a whole window starts over with a new thread. If the
+// investigation cannot be queued, the error makes the sender retry, and the
+// retry reuses the header message already posted.
+func (s *Server) handle(hook *Webhook) error {
+	key := hook.groupKey()
+	window := cmp.Or(s.cfg.GroupWindow, defaultGroupWindow)
+	now := time.Now()
+
+	group := s.lookup(key, hook, now, window)
+	if group == nil {
+		slog.Info("resolved alert without an investigation", "alert", hook.name(), "group", key)
+		return nil
+	}
+	defer group.mu.Unlock()
+
+	if hook.Status != statusFiring {
+		if !group.submitted || group.resolved {
+			slog.Info("resolved alert without an investigation", "alert", hook.name(), "group", key)
+			return nil
+		}
+		group.resolved = true
+		slog.Info("alert resolved", "alert", group.name, "group", key, "thread", group.ts)
+		return s.updateHeader(group, hook)
+	}
+
+	if group.submitted {
+		if now.Sub(group.lastFired) < window {
+			group.fired++
+			group.lastFired = now
+			group.resolved = false
+			slog.Info("repeated alert suppressed", "alert", group.name, "group", key, "fired", group.fired, "thread", group.ts)
+			return s.updateHeader(group, hook)
+		}
+		// Quiet for a whole window but not swept yet: start over.
+		group.ts, group.submitted, group.resolved = "", false, false
+	}
+
+	if group.ts == "" {
+		group.name = hook.name()
+		group.channel, group.playbooks = s.route(hook.labels())
+		group.started, group.lastFired, group.fired = now, now, 1
+		ts, err := s.gw.StartThread(group.channel, headerText(hook, group))
+		if err != nil {
+			return fmt.Errorf("posting alert: %w", err)
+		}
+		group.ts = ts
+	}
+
+	err := s.gw.Submit(islack.Message{
+		Channel:  group.channel,
+		ThreadTS: group.ts,
+		UserName: alertSender,
+		Text:     investigationPrompt(hook, group.playbooks),
+	})
+	if err != nil {
+		return fmt.Errorf("starting investigation: %w", err)
+	}
+	group.submitted = true
+
+	slog.Info("investigation started for alert", "alert", group.name, "group", key, "channel", group.channel, "thread", group.ts, "playbooks", group.playbooks)
+	return nil
+}
+
+// lookup returns the group for key locked, creating it for a firing alert.
+// It returns nil for a resolved alert of an unknown group.
+func (s *Server) lookup(key string, hook *Webhook, now time.Time, window time.Duration) *alertGroup {
+	for {
+		s.mu.Lock()
+		s.sweep(now, window)
+		group, known := s.groups[key]
+		if !known {
+			if hook.Status != statusFiring {
+				s.mu.Unlock()
+				return nil
+			}
+			group = &alertGroup{}
+			s.groups[key] = group
+		}
+		s.mu.Unlock()
+
+		group.mu.Lock()
+		if !group.removed {
+			return group
+		}
+		// Swept between the lookup and the lock; look again.
+		group.mu.Unlock()
+	}
+}
+
+func (s *Server) updateHeader(group *alertGroup, hook *Webhook) error {
+	if err := s.gw.EditMessage(group.channel, group.ts, headerText(hook, group)); err != nil {
+		return fmt.Errorf("updating alert: %w", err)
+	}
+	return nil
+}
+
+// sweep forgets groups that have not fired for a window. Groups busy with a
+// notification are left for the next sweep. Called with s.mu held.
+func (s *Server) sweep(now time.Time, window time.Duration) {
+	for key, g := range s.groups {
+		if !g.mu.TryLock() {
+			continue
+		}
+		if !g.lastFired.IsZero() && now.Sub(g.lastFired) >= window {
+			g.removed = true
+			delete(s.groups, key)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// route picks the channel and playbook hints for an alert's labels.
+func (s *Server) route(labels map[string]string) (string, []string) {
+	for _, route := range s.cfg.Routes {
+		if matches(route.Match, labels) {
+			return cmp.Or(route.Channel, s.cfg.DefaultChannel), route.Playbooks
+		}
+	}
+	return s.cfg.DefaultChannel, nil
+}
+
+func matches(match, labels map[string]string) bool {
+	for label, pattern := range match {
+		if ok, _ := path.Match(pattern, labels[label]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func headerText(hook *Webhook, group *alertGroup) string {
+	var b strings.Builder
+	if group.resolved {
+		fmt.Fprintf(&b, ":white_check_mark: **RESOLVED: %s**", group.name)
+	} else {
+		fmt.Fprintf(&b, ":rotating_light: **FIRING: %s**", group.name)
+		if n := hook.count(statusFiring); n > 1 {
+			fmt.Fprintf(&b, " (%d alerts)", n)
+		}
+	}
+	if severity := hook.labels()["severity"]; severity != "" {
+		fmt.Fprintf(&b, " · severity `%s`", severity)
+	}
+	if summary := cmp.Or(hook.annotation("summary"), hook.Title); summary != "" {
+		b.WriteString("\n" + summary)
+	}
+	if labels := formatLabels(hook.labels()); labels != "" {
+		fmt.Fprintf(&b, "\n`%s`", labels)
+	}
+	if links := hook.links(); links != "" {
+		b.WriteString("\n" + links)
+	}
+	if group.fired > 1 {
+		fmt.Fprintf(&b, "\n_Fired %d times since %s, last at %s; repeats are not investigated again._",
+			group.fired, group.started.UTC().Format("15:04 UTC"), group.lastFired.UTC().Format("15:04 UTC"))
+	}
+	return b.String()
+}
+
+func investigationPrompt(hook *Webhook, playbooks []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "An alert is firing. Investigate its likely cause.\n\nAlert: %s", hook.name())
+	if n := hook.count(statusFiring); n > 1 {
+		fmt.Fprintf(&b, " (%d alerts firing)", n)
+	}
+	if summary := cmp.Or(hook.annotation("summary"), hook.Title); summary != "" {
+		fmt.Fprintf(&b, "\nSummary: %s", summary)
+	}
+	if description := cmp.Or(hook.annotation("description"), hook.Message); description != "" {
+		fmt.Fprintf(&b, "\nDescription: %s", description)
+	}
+	if labels := formatLabels(hook.labels()); labels != "" {
+		fmt.Fprintf(&b, "\nLabels: %s", labels)
+	}
+	if started := hook.startedAt(); !started.IsZero() {
+		fmt.Fprintf(&b, "\nStarted: %s", started.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+	for _, a := range hook.Alerts {
+		if a.ValueString != "" {
+			fmt.Fprintf(&b, "\nValues: %s", a.ValueString)
+			break
+		}
+	}
+	if len(playbooks) > 0 {
+		fmt.Fprintf(&b, "\n[Suggested playbooks: %s]", strings.Join(playbooks, ", "))
+	}
+	return b.String()
+}
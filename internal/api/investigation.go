@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/agent"
+)
+
+// Investigation states.
+const (
+	statusRunning   = "running"
+	statusCompleted = "completed"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+)
+
+// eventError ends a turn that failed or was cancelled; it is sent on the
+// progress stream after the agent's own events.
+const eventError agent.EventKind = "error"
+
+// investigation is an API conversation with the coordinator. Each follow-up
+// is a new turn in the same session; events and the result are per turn.
+type investigation struct {
+	id   string
+	user string
+
+	mu          sync.Mutex
+	status      string
+	result      string
+	err         string
+	created     time.Time
+	updated     time.Time
+	turns       int
+	events      []agent.Event
+	subscribers map[*subscription]struct{}
+	cancel      context.CancelFunc
+}
+
+// subscription is one client of an investigation's progress stream.
+type subscription struct {
+	events chan agent.Event
+	// terminal is the turn's final or error event. It is set before events
+	// is closed, so a client that missed it can still send it.
+	terminal agent.Event
+	// sentTerminal is only used by the reading client.
+	sentTerminal bool
+}
+
+// statusResponse is the JSON view of an investigation.
+type statusResponse struct {
+	ID      string    `json:"id"`
+	Status  string    `json:"status"`
+	Turns   int       `json:"turns"`
+	Created time.Time `json:"created_at"`
+	Updated time.Time `json:"updated_at"`
+	Result  string    `json:"result,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func newInvestigation(user string) *investigation {
+	now := time.Now()
+	return &investigation{
+		id:          newID(),
+		user:        user,
+		created:     now,
+		updated:     now,
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "inv_" + hex.EncodeToString(b)
+}
+
+func (inv *investigation) view() statusResponse {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return statusResponse{
+		ID:      inv.id,
+		Status:  inv.status,
+		Turns:   inv.turns,
+		Created: inv.created,
+		Updated: inv.updated,
+		Result:  inv.result,
+		Error:   inv.err,
+	}
+}
+
+// begin starts a new turn and reports false if one is already running.
+func (inv *investigation) begin(cancel context.CancelFunc) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.status == statusRunning {
+		return false
+	}
+	inv.status = statusRunning
+	inv.result, inv.err = "", ""
+	inv.events = nil
+	inv.turns++
+	inv.updated = time.Now()
+	inv.cancel = cancel
+	return true
+}
+
+// publish records an event and sends it to subscribers.
+func (inv *investigation) publish(e agent.Event) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.publishLocked(e)
+}
+
+// publishLocked records an event and sends it to subscribers. Slow
+// subscribers miss events rather than block the investigation; the terminal
+// event is handed over by finish.
+func (inv *investigation) publishLocked(e agent.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	inv.events = append(inv.events, e)
+	inv.updated = e.Time
+	for sub := range inv.subscribers {
+		select {
+		case sub.events <- e:
+		default:
+		}
+	}
+}
+
+// finish ends the current turn and closes all subscriptions. A completed
+// turn's response was already sent as the agent's final event.
+func (inv *investigation) finish(status, result, errText string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.status = status
+	inv.result = result
+	inv.err = errText
+	inv.cancel = nil
+
+	if errText != "" {
+		inv.publishLocked(agent.Event{Kind: eventError, Error: errText, Text: result})
+	}
+	var terminal agent.Event
+	if n := len(inv.events); n > 0 && isTerminal(inv.events[n-1]) {
+		terminal = inv.events[n-1]
+	}
+	for sub := range inv.subscribers {
+		sub.terminal = terminal
+		close(sub.events)
+	}
+	clear(inv.subscribers)
+}
+
+// isTerminal reports whether e ends a turn.
+func isTerminal(e agent.Event) bool {
+	return e.Kind == agent.EventFinal || e.Kind == eventError
+}
+
+// subscribe returns the events of the current turn so far and a
+// subscription for the rest, whose channel is closed when the turn ends. The
+// subscription is nil when no turn is running.
+func (inv *investigation) subscribe() ([]agent.Event, *subscription) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	past := append([]agent.Event(nil), inv.events...)
+	if inv.status != statusRunning {
+		return past, nil
+	}
+	sub := &subscription{events: make(chan agent.Event, 64)}
+	inv.subscribers[sub] = struct{}{}
+	return past, sub
+}
+
+func (inv *investigation) unsubscribe(sub *subscription) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if _, ok := inv.subscribers[sub]; ok {
+		delete(inv.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// HandleEvent publishes the agent's progress events on the stream.
+func (inv *investigation) HandleEvent(e agent.Event) {
+	inv.publish(e)
+}
+
+// expired reports whether a finished investigation is older than retention.
+func (inv *investigation) expired(retention time.Duration) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.status != statusRunning && time.Since(inv.updated) > retention
+}
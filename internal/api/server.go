@@ -0,0 +1,359 @@
+// Package api serves an HTTP/JSON API for running investigations with the
+// coordinator without Slack, with a Server-Sent Events stream of progress.
+package api
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/agent"
+	"github.com/illenko/incidently/internal/config"
+)
+
+const (
+	defaultMaxConcurrent = 4
+	defaultRetention     = 24 * time.Hour
+	maxRequestBytes      = 1 << 20
+	shutdownTimeout      = 5 * time.Second
+	heartbeatInterval    = 15 * time.Second
+	// sessionChannel is the session namespace for API investigations; the
+	// investigation ID is the thread.
+	sessionChannel = "api"
+	defaultUser    = "api"
+)
+
+// Server runs investigations requested over HTTP.
+type Server struct {
+	cfg config.APIConfig
+	svc *agent.Service
+	sem chan struct{}
+
+	ctx            context.Context
+	mu             sync.Mutex
+	investigations map[string]*investigation
+}
+
+// messageRequest is the body of a new investigation or a follow-up.
+type messageRequest struct {
+	Text string `json:"text"`
+	// User identifies the caller to the coordinator; follow-ups keep the
+	// investigation's user.
+	User string `json:"user"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(cfg config.APIConfig, svc *agent.Service) *Server {
+	return &Server{
+		cfg:            cfg,
+		svc:            svc,
+		sem:            make(chan struct{}, cmp.Or(cfg.MaxConcurrent, defaultMaxConcurrent)),
+		investigations: make(map[string]*investigation),
+	}
+}
+
+// Run serves the API until ctx is cancelled. Running investigations are
+// cancelled with it.
+func (s *Server) Run(ctx context.Context) error {
+	s.ctx = ctx
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/investigations", s.handleCreate)
+	mux.HandleFunc("GET /v1/investigations/{id}", s.handleStatus)
+	mux.HandleFunc("POST /v1/investigations/{id}/messages", s.handleFollowUp)
+	mux.HandleFunc("POST /v1/investigations/{id}/cancel", s.handleCancel)
+	mux.HandleFunc("GET /v1/investigations/{id}/result", s.handleResult)
+	mux.HandleFunc("GET /v1/investigations/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := &http.Server{
+		Addr:              s.cfg.Listen,
+		Handler:           s.authorize(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("api server listening", "address", s.cfg.Listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving api: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || s.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMessage(w, r)
+	if !ok {
+		return
+	}
+
+	inv := newInvestigation(cmp.Or(req.User, defaultUser))
+	if !s.start(w, inv, req.Text) {
+		return
+	}
+
+	s.mu.Lock()
+	s.sweep()
+	s.investigations[inv.id] = inv
+	s.mu.Unlock()
+
+	slog.Info("api investigation started", "investigation", inv.id, "user", inv.user)
+	writeJSON(w, http.StatusAccepted, inv.view())
+}
+
+func (s *Server) handleFollowUp(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeMessage(w, r)
+	if !ok {
+		return
+	}
+	if !s.start(w, inv, req.Text) {
+		return
+	}
+
+	slog.Info("api follow-up started", "investigation", inv.id, "user", inv.user)
+	writeJSON(w, http.StatusAccepted, inv.view())
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	inv.mu.Lock()
+	cancel := inv.cancel
+	inv.mu.Unlock()
+	if cancel == nil {
+		writeError(w, http.StatusConflict, "investigation is not running")
+		return
+	}
+
+	slog.Info("cancelling api investigation", "investigation", inv.id)
+	cancel()
+	writeJSON(w, http.StatusAccepted, inv.view())
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, inv.view())
+}
+
+func (s *Server) handleResult(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	view := inv.view()
+	if view.Status == statusRunning {
+		writeError(w, http.StatusConflict, "investigation is still running")
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// handleEvents streams the current turn's progress as Server-Sent Events:
+// events so far, then new ones until the turn ends with a final or error
+// event. A finished turn replays its events and closes the stream.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	past, sub := inv.subscribe()
+	if sub != nil {
+		defer inv.unsubscribe(sub)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range past {
+		if isTerminal(e) && sub != nil {
+			sub.sentTerminal = true
+		}
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+	if sub == nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				// The turn ended. Send its final or error event if it was
+				// dropped because this client fell behind.
+				if sub.terminal.Kind != "" && !sub.sentTerminal {
+					writeEvent(w, sub.terminal)
+					flusher.Flush()
+				}
+				return
+			}
+			if isTerminal(e) {
+				sub.sentTerminal = true
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// start runs a new turn of inv in the background. It writes an error
+// response and returns false if the turn cannot start.
+func (s *Server) start(w http.ResponseWriter, inv *investigation, text string) bool {
+	select {
+	case s.sem <- struct{}{}:
+	default:
+		writeError(w, http.StatusTooManyRequests, "too many investigations running, try again later")
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	if !inv.begin(cancel) {
+		cancel()
+		<-s.sem
+		writeError(w, http.StatusConflict, "investigation is still running")
+		return false
+	}
+
+	go func() {
+		defer func() { <-s.sem }()
+		defer cancel()
+		s.run(ctx, inv, text)
+	}()
+	return true
+}
+
+func (s *Server) run(ctx context.Context, inv *investigation, text string) {
+	response, err := s.svc.HandleMessage(ctx, agent.Request{
+		Channel:  sessionChannel,
+		ThreadTS: inv.id,
+		UserID:   inv.user,
+		UserName: inv.user,
+		Text:     text,
+	}, inv)
+
+	switch {
+	case errors.Is(err, agent.ErrCancelled):
+		slog.Info("api investigation cancelled", "investigation", inv.id)
+		inv.finish(statusCancelled, response, "investigation cancelled")
+	case err != nil:
+		slog.Error("agent error", "error", err, "investigation", inv.id)
+		inv.finish(statusFailed, "", "something went wrong during analysis")
+	default:
+		slog.Info("api investigation completed", "investigation", inv.id, "length", len(response))
+		inv.finish(statusCompleted, response, "")
+	}
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*investigation, bool) {
+	s.mu.Lock()
+	inv, ok := s.investigations[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "investigation not found")
+	}
+	return inv, ok
+}
+
+// sweep forgets finished investigations past the retention period and
+// deletes their sessions in the background. Called with s.mu held.
+func (s *Server) sweep() {
+	retention := cmp.Or(s.cfg.Retention, defaultRetention)
+	var expired []string
+	for id, inv := range s.investigations {
+		if inv.expired(retention) {
+			delete(s.investigations, id)
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	go func() {
+		for _, id := range expired {
+			if err := s.svc.DeleteSession(s.ctx, sessionChannel, id); err != nil {
+				slog.Warn("failed to delete api investigation session", "error", err, "investigation", id)
+			}
+		}
+	}()
+}
+
+func decodeMessage(w http.ResponseWriter, r *http.Request) (messageRequest, bool) {
+	var req messageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return req, false
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return req, false
+	}
+	return req, true
+}
+
+func writeEvent(w http.ResponseWriter, e agent.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
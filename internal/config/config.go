@@ -3,9 +3,12 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,16 +19,209 @@ type Config struct {
 	Coordinator  CoordinatorConfig `yaml:"coordinator"`
 	Agents       []AgentConfig     `yaml:"agents"`
 	PlaybooksDir string            `yaml:"playbooks_dir"`
+	// PlaybookSources are loaded in addition to PlaybooksDir.
+	PlaybookSources []PlaybookSourceConfig `yaml:"playbook_sources"`
+	Sessions        SessionConfig          `yaml:"sessions"`
+	Alerts          AlertsConfig           `yaml:"alerts"`
+	API             APIConfig              `yaml:"api"`
+	Debug           DebugConfig            `yaml:"debug"`
 }
 
+const (
+	PlaybookSourceDir = "dir"
+	PlaybookSourceGit = "git"
+)
+
+// PlaybookSourceConfig is a place playbooks are loaded from, recursively.
+// Playbook names are their paths below the source root without ".md",
+// prefixed with Prefix: "payments/apple-pay". A dir source reads Path; a git
+// source fetches Ref (a branch or tag, default HEAD) of the repository at
+// URL into CacheDir every Interval and reads Path below the repository root.
+// Zero values use the loader defaults.
+type PlaybookSourceConfig struct {
+	Name     string        `yaml:"name"`
+	Type     string        `yaml:"type"`
+	Path     string        `yaml:"path"`
+	Prefix   string        `yaml:"prefix"`
+	URL      string        `yaml:"url"`
+	Ref      string        `yaml:"ref"`
+	Interval time.Duration `yaml:"interval"`
+	CacheDir string        `yaml:"cache_dir"`
+}
+
+// SlackConfig holds Slack credentials and message processing limits. Workers
+// bounds concurrent investigations and MaxQueueDepth bounds how many messages
+// may wait for a free worker. DedupeTTL is how long event IDs are remembered to
+// drop redelivered events. Reports longer than ReportFileThreshold characters
+// are posted as a summary with the full report attached as a file. Zero values
+// use the gateway defaults.
 type SlackConfig struct {
-	AppToken string `yaml:"app_token"`
-	BotToken string `yaml:"bot_token"`
+	AppToken            string        `yaml:"app_token"`
+	BotToken            string        `yaml:"bot_token"`
+	Workers             int           `yaml:"workers"`
+	MaxQueueDepth       int           `yaml:"max_queue_depth"`
+	DedupeTTL           time.Duration `yaml:"dedupe_ttl"`
+	ReportFileThreshold int           `yaml:"report_file_threshold"`
+	// Triggers applies to every channel; ChannelTriggers overrides it per
+	// channel ID.
+	Triggers        TriggerConfig            `yaml:"triggers"`
+	ChannelTriggers map[string]TriggerConfig `yaml:"channel_triggers"`
+	ThreadHistory   ThreadHistoryConfig      `yaml:"thread_history"`
+	Access          AccessConfig             `yaml:"access"`
+}
+
+// ThreadHistoryConfig bounds the earlier thread messages imported when the bot
+// is first asked in an existing thread. Zero values use the gateway defaults;
+// Disabled turns the import off.
+type ThreadHistoryConfig struct {
+	Disabled    bool `yaml:"disabled"`
+	MaxMessages int  `yaml:"max_messages"`
+	MaxChars    int  `yaml:"max_chars"`
+}
+
+// TriggerConfig selects which messages the bot responds to. Unset fields
+// inherit the next level: channel, then global, then the default. By default
+// the bot answers mentions and direct messages; ThreadReplies makes it also
+// answer unmentioned replies in threads it already takes part in.
+type TriggerConfig struct {
+	Mentions       *bool `yaml:"mentions"`
+	DirectMessages *bool `yaml:"direct_messages"`
+	ThreadReplies  *bool `yaml:"thread_replies"`
+}
+
+// APIConfig configures the HTTP/JSON API for driving investigations without
+// Slack. It is disabled unless Listen is set. Requests must send Token, which
+// is required since the API is not subject to the Slack access rules, as a
+// bearer token. MaxConcurrent bounds investigations running
+// at once and Retention is how long finished investigations stay queryable;
+// zero values use the server defaults.
+type APIConfig struct {
+	Listen        string        `yaml:"listen"`
+	Token         string        `yaml:"token"`
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	Retention     time.Duration `yaml:"retention"`
+}
+
+// DebugConfig configures the debug listener, which serves process metrics
+// (expvar) at /debug/vars without authentication. It is disabled unless Listen
+// is set; bind it to a local or cluster-internal address.
+type DebugConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// AlertsConfig configures the webhook server that turns Alertmanager and
+// Grafana alerts into investigations. It is disabled unless Listen is set.
+// Webhooks must send Token, which is required, as a bearer token. Firings of
+// an alert group less than GroupWindow after it last fired reuse its thread
+// and investigation; set it above Alertmanager's repeat_interval so a
+// continuously firing group is not investigated again.
+type AlertsConfig struct {
+	Listen         string        `yaml:"listen"`
+	Token          string        `yaml:"token"`
+	DefaultChannel string        `yaml:"default_channel"`
+	GroupWindow    time.Duration `yaml:"group_window"`
+	Routes         []AlertRoute  `yaml:"routes"`
+}
+
+// AlertRoute sends alerts whose labels match every Match entry (values are
+// glob patterns) to Channel, suggesting Playbooks to the coordinator. The
+// first matching route wins; unmatched alerts go to the default channel.
+type AlertRoute struct {
+	Match     map[string]string `yaml:"match"`
+	Channel   string            `yaml:"channel"`
+	Playbooks []string          `yaml:"playbooks"`
 }
 
+// Access rule actions.
+const (
+	AccessAllow = "allow"
+	AccessDeny  = "deny"
+)
+
+// AccessConfig controls who may start investigations and where. Rules are
+// checked in order and the first matching rule decides; requests that match
+// no rule get Default ("allow" unless set). Denied requests are answered with
+// RefusalMessage.
+type AccessConfig struct {
+	Default        string       `yaml:"default"`
+	RefusalMessage string       `yaml:"refusal_message"`
+	Rules          []AccessRule `yaml:"rules"`
+}
+
+// AccessRule matches requests by Slack channel, user and user group IDs.
+// Every non-empty selector must match, except that Users and UserGroups match
+// when either does; a rule without selectors matches everything. Playbooks
+// (glob patterns) and Agents (specialist names) limit what an allowed request
+// may use; empty means no limit.
+type AccessRule struct {
+	Name       string   `yaml:"name"`
+	Action     string   `yaml:"action"`
+	Channels   []string `yaml:"channels"`
+	Users      []string `yaml:"users"`
+	UserGroups []string `yaml:"user_groups"`
+	Playbooks  []string `yaml:"playbooks"`
+	Agents     []string `yaml:"agents"`
+}
+
+// MCP transports supported in MCPServerConfig.Transport.
+const (
+	TransportSSE        = "sse"
+	TransportStreamable = "streamable_http"
+	TransportStdio      = "stdio"
+)
+
+// MCPServerConfig describes how to reach one MCP server. SSE (the default)
+// uses URL, streamable_http uses Endpoint, and stdio launches Command with
+// Args and extra Env variables.
+//
+// HTTP transports can authenticate with static Headers (${ENV} references are
+// resolved at load time), a BearerTokenFile that is re-read whenever it
+// changes, and client certificates in TLS.
 type MCPServerConfig struct {
-	Name string `yaml:"name"`
-	URL  string `yaml:"url"`
+	Name            string            `yaml:"name"`
+	Transport       string            `yaml:"transport"`
+	URL             string            `yaml:"url"`
+	Endpoint        string            `yaml:"endpoint"`
+	Command         string            `yaml:"command"`
+	Args            []string          `yaml:"args"`
+	Env             map[string]string `yaml:"env"`
+	Headers         map[string]string `yaml:"headers"`
+	BearerTokenFile string            `yaml:"bearer_token_file"`
+	TLS             TLSConfig         `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	CAFile   string `yaml:"ca_file"`
+}
+
+// Address returns a human-readable location of the server for logging.
+func (m MCPServerConfig) Address() string {
+	switch m.Transport {
+	case TransportStreamable:
+		return m.Endpoint
+	case TransportStdio:
+		return strings.Join(append([]string{m.Command}, m.Args...), " ")
+	default:
+		return m.URL
+	}
+}
+
+// SessionConfig selects where conversation history is kept. Backend is one of
+// "memory" (default, lost on restart), "sqlite" or "redis".
+type SessionConfig struct {
+	Backend string      `yaml:"backend"`
+	Path    string      `yaml:"path"`
+	Redis   RedisConfig `yaml:"redis"`
+}
+
+type RedisConfig struct {
+	Addr      string        `yaml:"addr"`
+	Password  string        `yaml:"password"`
+	DB        int           `yaml:"db"`
+	KeyPrefix string        `yaml:"key_prefix"`
+	TTL       time.Duration `yaml:"ttl"`
 }
 
 type CoordinatorConfig struct {
@@ -35,18 +231,36 @@ type CoordinatorConfig struct {
 	Temperature float64 `yaml:"temperature"`
 }
 
+// AgentConfig defines a specialist. Tools selects whole MCP servers;
+// IncludeTools and ExcludeTools narrow them down to individual tools using
+// glob patterns, either bare ("query_*") or qualified by server
+// ("grafana/list_*").
 type AgentConfig struct {
-	Name        string   `yaml:"name"`
-	Model       string   `yaml:"model"`
-	Description string   `yaml:"description"`
-	Instruction string   `yaml:"instruction"`
-	Temperature float64  `yaml:"temperature"`
-	Tools       []string `yaml:"tools"`
+	Name         string   `yaml:"name"`
+	Model        string   `yaml:"model"`
+	Description  string   `yaml:"description"`
+	Instruction  string   `yaml:"instruction"`
+	Temperature  float64  `yaml:"temperature"`
+	Tools        []string `yaml:"tools"`
+	IncludeTools []string `yaml:"include_tools"`
+	ExcludeTools []string `yaml:"exclude_tools"`
 }
 
 var envVarPattern = regexp.MustCompile(`\$\{([^}]+)}`)
 
+// Load reads, resolves and validates the config file at path.
 func Load(path string) (*Config, error) {
+	return load(path, true)
+}
+
+// LoadLocal loads the config like Load but validates only what the agents
+// need, ignoring the Slack, alert webhook and API settings. It is used to run
+// the bot from a terminal without a Slack app.
+func LoadLocal(path string) (*Config, error) {
+	return load(path, false)
+}
+
+func load(path string, frontends bool) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
@@ -66,23 +280,17 @@ func Load(path string) (*Config, error) {
 	}
 
 	baseDir := filepath.Dir(path)
-	if err := cfg.validate(baseDir); err != nil {
+	cfg.resolvePaths(baseDir)
+	if err := cfg.validate(frontends); err != nil {
 		return nil, fmt.Errorf("validating config: %w", err)
 	}
 
 	return &cfg, nil
 }
 
-func (c *Config) validate(baseDir string) error {
+func (c *Config) validate(frontends bool) error {
 	var errs []string
 
-	if c.Slack.AppToken == "" {
-		errs = append(errs, "slack.app_token is required")
-	}
-	if c.Slack.BotToken == "" {
-		errs = append(errs, "slack.bot_token is required")
-	}
-
 	if c.Coordinator.Model == "" {
 		errs = append(errs, "coordinator.model is required")
 	}
@@ -90,8 +298,51 @@ func (c *Config) validate(baseDir string) error {
 		errs = append(errs, "coordinator.instruction is required")
 	}
 
-	if c.PlaybooksDir == "" {
-		errs = append(errs, "playbooks_dir is required")
+	if c.PlaybooksDir == "" && len(c.PlaybookSources) == 0 {
+		errs = append(errs, "playbooks_dir or playbook_sources is required")
+	}
+	sourceNames := make(map[string]bool)
+	for i, src := range c.PlaybookSources {
+		name := src.Name
+		if name == "" {
+			errs = append(errs, fmt.Sprintf("playbook_sources[%d]: name is required", i))
+			name = fmt.Sprintf("[%d]", i)
+		} else if sourceNames[name] {
+			errs = append(errs, fmt.Sprintf("playbook_sources.%s: duplicate name", name))
+		}
+		sourceNames[name] = true
+		switch src.Type {
+		case "", PlaybookSourceDir:
+			if src.Path == "" {
+				errs = append(errs, fmt.Sprintf("playbook_sources.%s: path is required for dir sources", name))
+			}
+		case PlaybookSourceGit:
+			if src.URL == "" {
+				errs = append(errs, fmt.Sprintf("playbook_sources.%s: url is required for git sources", name))
+			}
+			if src.Interval < 0 {
+				errs = append(errs, fmt.Sprintf("playbook_sources.%s: interval must not be negative", name))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("playbook_sources.%s: type %q is not supported (dir, git)", name, src.Type))
+		}
+		if strings.HasPrefix(src.Prefix, "/") || strings.HasSuffix(src.Prefix, "/") {
+			errs = append(errs, fmt.Sprintf("playbook_sources.%s: prefix must not start or end with /", name))
+		}
+	}
+
+	switch c.Sessions.Backend {
+	case "", "memory":
+	case "sqlite":
+		if c.Sessions.Path == "" {
+			errs = append(errs, "sessions.path is required for sqlite backend")
+		}
+	case "redis":
+		if c.Sessions.Redis.Addr == "" {
+			errs = append(errs, "sessions.redis.addr is required for redis backend")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("sessions.backend %q is not supported (memory, sqlite, redis)", c.Sessions.Backend))
 	}
 
 	mcpNames := make(map[string]bool)
@@ -99,15 +350,48 @@ func (c *Config) validate(baseDir string) error {
 		if mcp.Name == "" {
 			errs = append(errs, "mcp_servers: each server must have a name")
 		}
-		if mcp.URL == "" {
-			errs = append(errs, fmt.Sprintf("mcp_servers.%s: url is required", mcp.Name))
+		switch mcp.Transport {
+		case "", TransportSSE:
+			if mcp.URL == "" {
+				errs = append(errs, fmt.Sprintf("mcp_servers.%s: url is required", mcp.Name))
+			}
+		case TransportStreamable:
+			if mcp.Endpoint == "" {
+				errs = append(errs, fmt.Sprintf("mcp_servers.%s: endpoint is required for streamable_http transport", mcp.Name))
+			}
+		case TransportStdio:
+			if mcp.Command == "" {
+				errs = append(errs, fmt.Sprintf("mcp_servers.%s: command is required for stdio transport", mcp.Name))
+			}
+			if len(mcp.Headers) > 0 || mcp.BearerTokenFile != "" || mcp.TLS != (TLSConfig{}) {
+				errs = append(errs, fmt.Sprintf("mcp_servers.%s: headers, bearer_token_file and tls are not supported for stdio transport", mcp.Name))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("mcp_servers.%s: transport %q is not supported (sse, streamable_http, stdio)", mcp.Name, mcp.Transport))
+		}
+		for header, value := range mcp.Headers {
+			if envVarPattern.MatchString(value) {
+				errs = append(errs, fmt.Sprintf("mcp_servers.%s: header %s references an unset environment variable", mcp.Name, header))
+			}
+		}
+		if (mcp.TLS.CertFile == "") != (mcp.TLS.KeyFile == "") {
+			errs = append(errs, fmt.Sprintf("mcp_servers.%s: tls.cert_file and tls.key_file must be set together", mcp.Name))
+		}
+		for _, file := range []string{mcp.BearerTokenFile, mcp.TLS.CertFile, mcp.TLS.KeyFile, mcp.TLS.CAFile} {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				errs = append(errs, fmt.Sprintf("mcp_servers.%s: file not found: %s", mcp.Name, file))
+			}
 		}
 		mcpNames[mcp.Name] = true
 	}
 
-	instructionPath := resolveRelativePath(baseDir, c.Coordinator.Instruction)
-	if _, err := os.Stat(instructionPath); err != nil {
-		errs = append(errs, fmt.Sprintf("coordinator instruction file not found: %s", instructionPath))
+	if c.Coordinator.Instruction != "" {
+		if _, err := os.Stat(c.Coordinator.Instruction); err != nil {
+			errs = append(errs, fmt.Sprintf("coordinator instruction file not found: %s", c.Coordinator.Instruction))
+		}
 	}
 
 	for _, agent := range c.Agents {
@@ -120,9 +404,8 @@ func (c *Config) validate(baseDir string) error {
 		if agent.Instruction == "" {
 			errs = append(errs, fmt.Sprintf("agents.%s: instruction is required", agent.Name))
 		} else {
-			agentInstrPath := resolveRelativePath(baseDir, agent.Instruction)
-			if _, err := os.Stat(agentInstrPath); err != nil {
-				errs = append(errs, fmt.Sprintf("agents.%s: instruction file not found: %s", agent.Name, agentInstrPath))
+			if _, err := os.Stat(agent.Instruction); err != nil {
+				errs = append(errs, fmt.Sprintf("agents.%s: instruction file not found: %s", agent.Name, agent.Instruction))
 			}
 		}
 		for _, tool := range agent.Tools {
@@ -130,6 +413,18 @@ func (c *Config) validate(baseDir string) error {
 				errs = append(errs, fmt.Sprintf("agents.%s: tool %q references undefined MCP server", agent.Name, tool))
 			}
 		}
+		for _, pattern := range append(append([]string{}, agent.IncludeTools...), agent.ExcludeTools...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Sprintf("agents.%s: invalid tool pattern %q", agent.Name, pattern))
+			}
+			if server, _, ok := strings.Cut(pattern, "/"); ok && !slices.Contains(agent.Tools, server) {
+				errs = append(errs, fmt.Sprintf("agents.%s: tool pattern %q references MCP server not listed in tools", agent.Name, pattern))
+			}
+		}
+	}
+
+	if frontends {
+		errs = append(errs, c.validateFrontends()...)
 	}
 
 	if len(errs) > 0 {
@@ -138,6 +433,136 @@ func (c *Config) validate(baseDir string) error {
 	return nil
 }
 
+// validateFrontends checks the Slack, alert webhook and API settings.
+func (c *Config) validateFrontends() []string {
+	var errs []string
+
+	if c.Slack.AppToken == "" {
+		errs = append(errs, "slack.app_token is required")
+	}
+	if c.Slack.BotToken == "" {
+		errs = append(errs, "slack.bot_token is required")
+	}
+	if c.Slack.Workers < 0 {
+		errs = append(errs, "slack.workers must not be negative")
+	}
+	if c.Slack.MaxQueueDepth < 0 {
+		errs = append(errs, "slack.max_queue_depth must not be negative")
+	}
+	if c.Slack.ReportFileThreshold < 0 {
+		errs = append(errs, "slack.report_file_threshold must not be negative")
+	}
+	if c.Slack.ThreadHistory.MaxMessages < 0 || c.Slack.ThreadHistory.MaxChars < 0 {
+		errs = append(errs, "slack.thread_history limits must not be negative")
+	}
+
+	if c.Alerts.Listen != "" {
+		if c.Alerts.GroupWindow < 0 {
+			errs = append(errs, "alerts.group_window must not be negative")
+		}
+		switch {
+		case c.Alerts.Token == "":
+			errs = append(errs, "alerts.token is required when alerts.listen is set")
+		case envVarPattern.MatchString(c.Alerts.Token):
+			errs = append(errs, "alerts.token references an unset environment variable")
+		}
+		for i, route := range c.Alerts.Routes {
+			if route.Channel == "" && c.Alerts.DefaultChannel == "" {
+				errs = append(errs, fmt.Sprintf("alerts.routes[%d]: channel is required without alerts.default_channel", i))
+			}
+			for label, pattern := range route.Match {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, fmt.Sprintf("alerts.routes[%d]: invalid pattern %q for label %s", i, pattern, label))
+				}
+			}
+		}
+		if c.Alerts.DefaultChannel == "" && len(c.Alerts.Routes) == 0 {
+			errs = append(errs, "alerts.default_channel is required")
+		}
+	}
+
+	if c.API.Listen != "" {
+		if c.API.MaxConcurrent < 0 {
+			errs = append(errs, "api.max_concurrent must not be negative")
+		}
+		if c.API.Retention < 0 {
+			errs = append(errs, "api.retention must not be negative")
+		}
+		switch {
+		case c.API.Token == "":
+			errs = append(errs, "api.token is required when api.listen is set")
+		case envVarPattern.MatchString(c.API.Token):
+			errs = append(errs, "api.token references an unset environment variable")
+		}
+	}
+
+	switch c.Slack.Access.Default {
+	case "", AccessAllow, AccessDeny:
+	default:
+		errs = append(errs, fmt.Sprintf("slack.access.default %q is not supported (allow, deny)", c.Slack.Access.Default))
+	}
+	agentNames := make(map[string]bool)
+	for _, agent := range c.Agents {
+		agentNames[agent.Name] = true
+	}
+	for i, rule := range c.Slack.Access.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		switch rule.Action {
+		case AccessAllow:
+		case AccessDeny:
+			if len(rule.Playbooks) > 0 || len(rule.Agents) > 0 {
+				errs = append(errs, fmt.Sprintf("slack.access.rules.%s: playbooks and agents only apply to allow rules", name))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("slack.access.rules.%s: action must be allow or deny", name))
+		}
+		for _, pattern := range rule.Playbooks {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Sprintf("slack.access.rules.%s: invalid playbook pattern %q", name, pattern))
+			}
+		}
+		for _, agent := range rule.Agents {
+			if !agentNames[agent] {
+				errs = append(errs, fmt.Sprintf("slack.access.rules.%s: agent %q is not defined", name, agent))
+			}
+		}
+	}
+
+	return errs
+}
+
+// resolvePaths resolves the file paths in the config against the config
+// file's location, so instructions, playbooks and the MCP credential files
+// (read long after startup) do not depend on the working directory.
+func (c *Config) resolvePaths(baseDir string) {
+	paths := []*string{&c.Coordinator.Instruction, &c.PlaybooksDir}
+	for i := range c.Agents {
+		paths = append(paths, &c.Agents[i].Instruction)
+	}
+	for i := range c.PlaybookSources {
+		if c.PlaybookSources[i].Type != PlaybookSourceGit {
+			paths = append(paths, &c.PlaybookSources[i].Path)
+		}
+	}
+	for _, p := range paths {
+		if *p != "" {
+			*p = resolveRelativePath(baseDir, *p)
+		}
+	}
+
+	for i := range c.MCPServers {
+		mcp := &c.MCPServers[i]
+		for _, file := range []*string{&mcp.BearerTokenFile, &mcp.TLS.CertFile, &mcp.TLS.KeyFile, &mcp.TLS.CAFile} {
+			if *file != "" {
+				*file = resolveRelativePath(baseDir, *file)
+			}
+		}
+	}
+}
+
 func resolveRelativePath(baseDir, path string) string {
 	if filepath.IsAbs(path) {
 		return path
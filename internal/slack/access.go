@@ -0,0 +1,129 @@
+package slack
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/config"
+	"github.com/slack-go/slack"
+)
+
+const (
+	defaultRefusalMessage = "Sorry, I can't run investigations for you here. " +
+		"Please ask in one of the incident channels, or contact the bot's owners if you need access."
+	// userGroupCacheTTL is how long user group memberships are cached.
+	userGroupCacheTTL = 5 * time.Minute
+)
+
+// accessDecision is the outcome of checking a message against the access rules.
+type accessDecision struct {
+	allowed bool
+	rule    string
+	// playbooks and agents limit an allowed request; empty means no limit.
+	playbooks []string
+	agents    []string
+}
+
+// checkAccess applies the configured rules to msg. The first matching rule
+// decides; without a match the configured default applies. If a rule cannot
+// be evaluated because its user groups cannot be fetched, the message is
+// denied: skipping the rule could let a denied user fall through to an allow.
+func (g *Gateway) checkAccess(msg Message) accessDecision {
+	cfg := g.cfg.Access
+	for i, rule := range cfg.Rules {
+		name := cmp.Or(rule.Name, fmt.Sprintf("#%d", i+1))
+		matches, err := g.ruleMatches(rule, msg)
+		if err != nil {
+			slog.Error("access rule could not be evaluated, denying", "error", err, "rule", name, "user", msg.UserID)
+			return accessDecision{allowed: false, rule: name}
+		}
+		if !matches {
+			continue
+		}
+		return accessDecision{
+			allowed:   rule.Action == config.AccessAllow,
+			rule:      name,
+			playbooks: rule.Playbooks,
+			agents:    rule.Agents,
+		}
+	}
+	return accessDecision{allowed: cfg.Default != config.AccessDeny, rule: "default"}
+}
+
+func (g *Gateway) ruleMatches(rule config.AccessRule, msg Message) (bool, error) {
+	if len(rule.Channels) > 0 && !slices.Contains(rule.Channels, msg.Channel) {
+		return false, nil
+	}
+	if len(rule.Users) == 0 && len(rule.UserGroups) == 0 {
+		return true, nil
+	}
+	if slices.Contains(rule.Users, msg.UserID) {
+		return true, nil
+	}
+	for _, group := range rule.UserGroups {
+		member, err := g.userGroups.contains(g.api, group, msg.UserID)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// refuse tells the sender, privately, that their request was denied.
+func (g *Gateway) refuse(msg Message) {
+	text := cmp.Or(g.cfg.Access.RefusalMessage, defaultRefusalMessage)
+	_, err := g.api.PostEphemeral(msg.Channel, msg.UserID,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionTS(msg.ThreadTS),
+	)
+	if err != nil {
+		slog.Error("failed to send refusal", "error", err, "thread", msg.ThreadTS, "user", msg.UserID)
+	}
+}
+
+// userGroupCache caches user group members, so access checks do not call
+// usergroups.users.list for every message.
+type userGroupCache struct {
+	mu     sync.Mutex
+	groups map[string]userGroupEntry
+}
+
+type userGroupEntry struct {
+	members []string
+	fetched time.Time
+}
+
+func newUserGroupCache() *userGroupCache {
+	return &userGroupCache{groups: make(map[string]userGroupEntry)}
+}
+
+// contains reports whether userID belongs to group. If the members cannot be
+// fetched, the last known members are used; without any, it fails.
+func (c *userGroupCache) contains(api *slack.Client, group, userID string) (bool, error) {
+	c.mu.Lock()
+	entry, ok := c.groups[group]
+	c.mu.Unlock()
+
+	if !ok || time.Since(entry.fetched) > userGroupCacheTTL {
+		members, err := api.GetUserGroupMembers(group)
+		switch {
+		case err != nil && !ok:
+			return false, fmt.Errorf("fetching members of user group %s: %w", group, err)
+		case err != nil:
+			slog.Error("failed to refresh user group members, using the last known", "error", err, "group", group)
+		default:
+			entry = userGroupEntry{members: members, fetched: time.Now()}
+			c.mu.Lock()
+			c.groups[group] = entry
+			c.mu.Unlock()
+		}
+	}
+	return slices.Contains(entry.members, userID), nil
+}
@@ -0,0 +1,329 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	maxHeaderChars      = 150
+	maxSectionChars     = 3000
+	maxBlocksPerMessage = 50
+)
+
+// renderBlocks converts an agent's Markdown report into Block Kit blocks:
+// top-level headings become header blocks, paragraphs become mrkdwn sections,
+// lists and code fences become rich_text, tables become preformatted text
+// and quotes become context blocks.
+func renderBlocks(md string) []slack.Block {
+	var blocks []slack.Block
+	for _, b := range parseMarkdown(md) {
+		switch b.kind {
+		case mdHeading:
+			if b.level <= 2 {
+				text := truncateRunes(plainText(parseInline(b.text)), maxHeaderChars)
+				blocks = append(blocks, slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, text, true, false)))
+				continue
+			}
+			blocks = append(blocks, sectionBlocks(mrkdwn(bold(parseInline(b.text))))...)
+
+		case mdParagraph:
+			blocks = append(blocks, sectionBlocks(mrkdwn(parseInline(b.text)))...)
+
+		case mdRule:
+			blocks = append(blocks, slack.NewDividerBlock())
+
+		case mdCode:
+			blocks = append(blocks, preformattedBlock(b.text))
+
+		case mdTable:
+			blocks = append(blocks, preformattedBlock(formatTable(b.rows)))
+
+		case mdList:
+			blocks = append(blocks, listBlock(b.items))
+
+		case mdQuote:
+			for _, chunk := range splitText(mrkdwn(parseInline(b.text)), maxSectionChars) {
+				blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, chunk, false, false)))
+			}
+		}
+	}
+	return blocks
+}
+
+// renderMrkdwn converts Markdown into a single mrkdwn string. It is the
+// message's text fallback, shown in notifications and by clients that do not
+// render blocks.
+func renderMrkdwn(md string) string {
+	var parts []string
+	for _, b := range parseMarkdown(md) {
+		switch b.kind {
+		case mdHeading:
+			parts = append(parts, mrkdwn(bold(parseInline(b.text))))
+
+		case mdParagraph:
+			parts = append(parts, mrkdwn(parseInline(b.text)))
+
+		case mdRule:
+			parts = append(parts, "---")
+
+		case mdCode:
+			parts = append(parts, "```\n"+escapeMrkdwn(b.text)+"\n```")
+
+		case mdTable:
+			parts = append(parts, "```\n"+escapeMrkdwn(formatTable(b.rows))+"\n```")
+
+		case mdList:
+			lines := make([]string, 0, len(b.items))
+			for _, item := range b.items {
+				marker := "•"
+				if item.ordered {
+					marker = fmt.Sprintf("%d.", item.number)
+				}
+				lines = append(lines, strings.Repeat("    ", item.level)+marker+" "+mrkdwn(parseInline(item.text)))
+			}
+			parts = append(parts, strings.Join(lines, "\n"))
+
+		case mdQuote:
+			lines := strings.Split(mrkdwn(parseInline(b.text)), "\n")
+			for i, line := range lines {
+				lines[i] = "> " + line
+			}
+			parts = append(parts, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func sectionBlocks(text string) []slack.Block {
+	var blocks []slack.Block
+	for _, chunk := range splitText(text, maxSectionChars) {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, chunk, false, false), nil, nil))
+	}
+	return blocks
+}
+
+func preformattedBlock(text string) slack.Block {
+	if strings.TrimSpace(text) == "" {
+		text = " "
+	}
+	pre := &slack.RichTextPreformatted{
+		RichTextSection: slack.RichTextSection{
+			Type:     slack.RTEPreformatted,
+			Elements: []slack.RichTextSectionElement{slack.NewRichTextSectionTextElement(text, nil)},
+		},
+	}
+	return slack.NewRichTextBlock("", pre)
+}
+
+// listBlock renders list items as rich_text lists. Consecutive items with the
+// same nesting level and list type share one list element.
+func listBlock(items []mdListItem) slack.Block {
+	var elements []slack.RichTextElement
+	var current *slack.RichTextList
+	for _, item := range items {
+		style := slack.RTEListBullet
+		if item.ordered {
+			style = slack.RTEListOrdered
+		}
+		if current == nil || current.Indent != item.level || current.Style != style {
+			current = slack.NewRichTextList(style, item.level)
+			if item.ordered && item.number > 1 {
+				current.Offset = item.number - 1
+			}
+			elements = append(elements, current)
+		}
+		current.Elements = append(current.Elements, slack.NewRichTextSection(richTextElements(parseInline(item.text))...))
+	}
+	return slack.NewRichTextBlock("", elements...)
+}
+
+func richTextElements(spans []inlineSpan) []slack.RichTextSectionElement {
+	elements := make([]slack.RichTextSectionElement, 0, len(spans))
+	for _, sp := range spans {
+		style := textStyle(sp.style)
+		switch sp.kind {
+		case spanLink:
+			elements = append(elements, slack.NewRichTextSectionLinkElement(sp.target, sp.text, style))
+		case spanEmoji:
+			elements = append(elements, slack.NewRichTextSectionEmojiElement(sp.target, 0, nil))
+		case spanUser:
+			elements = append(elements, slack.NewRichTextSectionUserElement(sp.target, nil))
+		case spanChannel:
+			elements = append(elements, &slack.RichTextSectionChannelElement{Type: slack.RTSEChannel, ChannelID: sp.target})
+		case spanBroadcast:
+			elements = append(elements, slack.NewRichTextSectionBroadcastElement(sp.target))
+		default:
+			elements = append(elements, slack.NewRichTextSectionTextElement(sp.text, style))
+		}
+	}
+	if len(elements) == 0 {
+		elements = append(elements, slack.NewRichTextSectionTextElement(" ", nil))
+	}
+	return elements
+}
+
+func textStyle(s slack.RichTextSectionTextStyle) *slack.RichTextSectionTextStyle {
+	if s == (slack.RichTextSectionTextStyle{}) {
+		return nil
+	}
+	return &s
+}
+
+func bold(spans []inlineSpan) []inlineSpan {
+	for i := range spans {
+		spans[i].style.Bold = true
+	}
+	return spans
+}
+
+// mrkdwn renders spans as Slack mrkdwn.
+func mrkdwn(spans []inlineSpan) string {
+	var b strings.Builder
+	for _, sp := range spans {
+		switch sp.kind {
+		case spanLink:
+			if sp.text == "" {
+				b.WriteString(styled("<"+sp.target+">", sp.style))
+			} else {
+				b.WriteString(styled("<"+sp.target+"|"+escapeMrkdwn(sp.text)+">", sp.style))
+			}
+		case spanEmoji:
+			b.WriteString(":" + sp.target + ":")
+		case spanUser:
+			b.WriteString("<@" + sp.target + ">")
+		case spanChannel:
+			b.WriteString("<#" + sp.target + ">")
+		case spanBroadcast:
+			b.WriteString("<!" + sp.target + ">")
+		default:
+			b.WriteString(styled(escapeMrkdwn(sp.text), sp.style))
+		}
+	}
+	return b.String()
+}
+
+func styled(text string, s slack.RichTextSectionTextStyle) string {
+	if s.Code {
+		text = "`" + text + "`"
+	}
+	if s.Strike {
+		text = wrap(text, "~")
+	}
+	if s.Italic {
+		text = wrap(text, "_")
+	}
+	if s.Bold {
+		text = wrap(text, "*")
+	}
+	return text
+}
+
+// wrap surrounds text with a mrkdwn marker. Surrounding whitespace is kept
+// outside the marker, since Slack ignores markers next to spaces.
+func wrap(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+var mrkdwnEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeMrkdwn(s string) string {
+	return mrkdwnEscaper.Replace(s)
+}
+
+// formatTable lays out table rows as aligned monospace text with a rule under
+// the header row.
+func formatTable(rows [][]string) string {
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	cells := make([][]string, len(rows))
+	widths := make([]int, cols)
+	for r, row := range rows {
+		cells[r] = make([]string, cols)
+		for c, cell := range row {
+			cells[r][c] = plainText(parseInline(cell))
+			widths[c] = max(widths[c], displayWidth(cells[r][c]))
+		}
+	}
+
+	var b strings.Builder
+	line := func(values []string) {
+		var l strings.Builder
+		for c, v := range values {
+			if c > 0 {
+				l.WriteString("  ")
+			}
+			l.WriteString(v)
+			l.WriteString(strings.Repeat(" ", widths[c]-displayWidth(v)))
+		}
+		b.WriteString(strings.TrimRight(l.String(), " "))
+		b.WriteByte('\n')
+	}
+	for r, row := range cells {
+		line(row)
+		if r == 0 {
+			rule := make([]string, cols)
+			for c, w := range widths {
+				rule[c] = strings.Repeat("-", w)
+			}
+			line(rule)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// displayWidth approximates the monospace width of s: emoji take two columns,
+// variation selectors and joiners none.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch {
+		case r == 0x200D || (r >= 0xFE00 && r <= 0xFE0F):
+		case r >= 0x1F000 || (r >= 0x2600 && r <= 0x27BF):
+			w += 2
+		default:
+			w++
+		}
+	}
+	return w
+}
+
+// splitText breaks text into chunks of at most limit bytes, preferring line
+// and then word boundaries.
+func splitText(text string, limit int) []string {
+	var chunks []string
+	for len(text) > limit {
+		cut := strings.LastIndex(text[:limit], "\n")
+		if cut <= 0 {
+			cut = strings.LastIndex(text[:limit], " ")
+		}
+		if cut <= 0 {
+			cut = limit
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n ")
+	}
+	return append(chunks, text)
+}
+
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
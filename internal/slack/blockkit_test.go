@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/render")
+
+// TestRender renders every testdata/render/*.md file and compares the Block
+// Kit JSON and the mrkdwn fallback with the .blocks.json and .mrkdwn golden
+// files next to it. Run with -update after an intended rendering change.
+func TestRender(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "render", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no inputs in testdata/render")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".md")
+		t.Run(name, func(t *testing.T) {
+			md, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks, err := json.MarshalIndent(renderBlocks(string(md)), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				golden string
+				got    []byte
+			}{
+				{golden: name + ".blocks.json", got: append(blocks, '\n')},
+				{golden: name + ".mrkdwn", got: []byte(renderMrkdwn(string(md)) + "\n")},
+			}
+			for _, tt := range tests {
+				path := filepath.Join("testdata", "render", tt.golden)
+				if *update {
+					if err := os.WriteFile(path, tt.got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v (run with -update to create it)", err)
+				}
+				if !bytes.Equal(tt.got, want) {
+					t.Errorf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", tt.golden, tt.got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		check func(t *testing.T, blocks []slack.Block)
+	}{
+		{
+			name:  "long paragraph is split into sections",
+			input: "long_section.md",
+			check: func(t *testing.T, blocks []slack.Block) {
+				sections := 0
+				for _, b := range blocks {
+					s, ok := b.(*slack.SectionBlock)
+					if !ok {
+						continue
+					}
+					sections++
+					if n := len(s.Text.Text); n > maxSectionChars {
+						t.Errorf("section has %d chars, limit is %d", n, maxSectionChars)
+					}
+				}
+				if sections < 2 {
+					t.Errorf("got %d sections, want the paragraph split in at least 2", sections)
+				}
+			},
+		},
+		{
+			name:  "long heading is truncated",
+			input: "long_header.md",
+			check: func(t *testing.T, blocks []slack.Block) {
+				h, ok := blocks[0].(*slack.HeaderBlock)
+				if !ok {
+					t.Fatalf("first block is %T, want a header", blocks[0])
+				}
+				text := []rune(h.Text.Text)
+				if len(text) != maxHeaderChars || text[len(text)-1] != '…' {
+					t.Errorf("header has %d runes ending in %q, want %d ending in …", len(text), text[len(text)-1], maxHeaderChars)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := os.ReadFile(filepath.Join("testdata", "render", tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, renderBlocks(string(md)))
+		})
+	}
+}
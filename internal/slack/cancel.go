@@ -0,0 +1,155 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+const (
+	cancelActionID = "cancel_investigation"
+	cancelReaction = "x"
+)
+
+// CancelError is the cancellation cause of an investigation stopped from Slack.
+type CancelError struct {
+	UserID string
+	// Via is how the investigation was stopped: "reaction", "reply" or "button".
+	Via string
+}
+
+func (e *CancelError) Error() string {
+	return fmt.Sprintf("investigation cancelled by %s via %s", e.UserID, e.Via)
+}
+
+// investigations tracks running investigations by thread so they can be
+// cancelled from Slack, and maps status messages back to their thread.
+type investigations struct {
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+	status  map[string]string // channel/status ts -> thread key
+}
+
+func newInvestigations() *investigations {
+	return &investigations{
+		running: make(map[string]context.CancelCauseFunc),
+		status:  make(map[string]string),
+	}
+}
+
+// BeginInvestigation returns a context that is cancelled when someone stops the
+// investigation in msg's thread. Call the returned function when it ends.
+// context.Cause reports a *CancelError for cancellations from Slack.
+func (g *Gateway) BeginInvestigation(ctx context.Context, msg Message) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := threadKey(msg)
+
+	g.investigations.mu.Lock()
+	g.investigations.running[key] = cancel
+	g.investigations.mu.Unlock()
+
+	return ctx, func() {
+		g.investigations.mu.Lock()
+		delete(g.investigations.running, key)
+		for status, k := range g.investigations.status {
+			if k == key {
+				delete(g.investigations.status, status)
+			}
+		}
+		g.investigations.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+func (g *Gateway) trackStatusMessage(channel, statusTS, key string) {
+	g.investigations.mu.Lock()
+	g.investigations.status[channel+"/"+statusTS] = key
+	g.investigations.mu.Unlock()
+}
+
+// cancelInvestigation stops the investigation running in a thread and reports
+// whether there was one.
+func (g *Gateway) cancelInvestigation(key, userID, via string) bool {
+	g.investigations.mu.Lock()
+	cancel, ok := g.investigations.running[key]
+	g.investigations.mu.Unlock()
+	if !ok {
+		return false
+	}
+	slog.Info("cancelling investigation", "thread", key, "user", userID, "via", via)
+	cancel(&CancelError{UserID: userID, Via: via})
+	return true
+}
+
+// requestStop stops the investigation in msg's thread on behalf of msg's
+// sender, if the access rules let them use the bot there. The check may call
+// the Slack API, so it runs off the event loop. done, if not nil, is called
+// after an allowed request with whether an investigation was running.
+func (g *Gateway) requestStop(msg Message, via string, done func(stopped bool)) {
+	go func() {
+		if access := g.checkAccess(msg); !access.allowed {
+			slog.Info("stop denied", "user", msg.UserID, "channel", msg.Channel, "thread", msg.ThreadTS, "via", via, "rule", access.rule)
+			g.refuse(msg)
+			return
+		}
+		stopped := g.cancelInvestigation(threadKey(msg), msg.UserID, via)
+		if done != nil {
+			done(stopped)
+		}
+	}()
+}
+
+// stopMessage returns the message on whose behalf userID stops the
+// investigation in the thread with key.
+func stopMessage(key, userID string) Message {
+	channel, threadTS, _ := strings.Cut(key, "/")
+	return Message{Channel: channel, ThreadTS: threadTS, UserID: userID}
+}
+
+func (g *Gateway) handleCancelReaction(evt *socketmode.Event, client *socketmode.Client) {
+	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		return
+	}
+	client.Ack(*evt.Request)
+
+	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.ReactionAddedEvent)
+	if !ok || ev.Reaction != cancelReaction {
+		return
+	}
+
+	g.investigations.mu.Lock()
+	key, ok := g.investigations.status[ev.Item.Channel+"/"+ev.Item.Timestamp]
+	g.investigations.mu.Unlock()
+	if ok {
+		g.requestStop(stopMessage(key, ev.User), "reaction", nil)
+	}
+}
+
+func (g *Gateway) handleCancelButton(evt *socketmode.Event, client *socketmode.Client) {
+	callback, ok := evt.Data.(slack.InteractionCallback)
+	if !ok {
+		return
+	}
+	client.Ack(*evt.Request)
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID == cancelActionID {
+			g.requestStop(stopMessage(action.Value, callback.User.ID), "button", nil)
+		}
+	}
+}
+
+func isStopCommand(text string) bool {
+	switch strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!")) {
+	case "stop", "cancel", "abort":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package slack
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupeTTL = 10 * time.Minute
+	// duplicateLogInterval is how often a changed duplicate count is logged,
+	// for deployments without the debug listener.
+	duplicateLogInterval = 15 * time.Minute
+)
+
+// duplicateEventsDropped counts Slack events ignored because they were
+// already handled, e.g. redeliveries after a slow ack or a socket reconnect.
+var duplicateEventsDropped = expvar.NewInt("slack_duplicate_events_dropped")
+
+// logDuplicateEvents logs the number of dropped duplicate events whenever it
+// has changed, until ctx is cancelled.
+func logDuplicateEvents(ctx context.Context) {
+	ticker := time.NewTicker(duplicateLogInterval)
+	defer ticker.Stop()
+	var last int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if n := duplicateEventsDropped.Value(); n != last {
+			slog.Info("duplicate slack events dropped", "total", n, "since_last", n-last)
+			last = n
+		}
+	}
+}
+
+// dedupeCache remembers recently seen event keys for a TTL.
+type dedupeCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newDedupeCache(ttl time.Duration) *dedupeCache {
+	if ttl <= 0 {
+		ttl = defaultDedupeTTL
+	}
+	return &dedupeCache{
+		ttl:       ttl,
+		seen:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// markSeen records all keys and reports whether any of them was already seen
+// within the TTL. Empty keys are ignored.
+func (c *dedupeCache) markSeen(keys ...string) (duplicate bool) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, t := range c.seen {
+			if now.Sub(t) > c.ttl {
+				delete(c.seen, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		if t, ok := c.seen[k]; ok && now.Sub(t) <= c.ttl {
+			duplicate = true
+		}
+		c.seen[k] = now
+	}
+	return duplicate
+}
@@ -2,10 +2,11 @@ package slack
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/illenko/incidently/internal/config"
 	"github.com/slack-go/slack"
@@ -16,14 +17,29 @@ import (
 type Message struct {
 	Channel  string
 	ThreadTS string
+	TS       string // timestamp of the message itself
 	UserID   string
+	UserName string
 	Text     string
+	// Playbooks and Agents are the limits of the access rule that allowed the
+	// message; empty means no limit.
+	Playbooks []string
+	Agents    []string
 }
 
 type Gateway struct {
-	api    *slack.Client
-	socket *socketmode.Client
-	botID  string
+	api        *slack.Client
+	socket     *socketmode.Client
+	cfg        config.SlackConfig
+	botID      string
+	seen       *dedupeCache
+	threads    *threadTracker
+	users      *userNames
+	userGroups *userGroupCache
+	pool       atomic.Pointer[workerPool] // set while Run is active
+	intake     *intake
+
+	investigations *investigations
 }
 
 func NewGateway(cfg config.SlackConfig) *Gateway {
@@ -35,11 +51,22 @@ func NewGateway(cfg config.SlackConfig) *Gateway {
 	socket := socketmode.New(api)
 
 	return &Gateway{
-		api:    api,
-		socket: socket,
+		api:        api,
+		socket:     socket,
+		cfg:        cfg,
+		seen:       newDedupeCache(cfg.DedupeTTL),
+		threads:    newThreadTracker(),
+		users:      newUserNames(),
+		userGroups: newUserGroupCache(),
+		intake:     newIntake(),
+
+		investigations: newInvestigations(),
 	}
 }
 
+// Run listens for mentions, direct messages and thread replies until ctx is
+// cancelled. Each message is handed to handler on a bounded worker pool;
+// messages in the same thread run one at a time.
 func (g *Gateway) Run(ctx context.Context, handler func(msg Message)) {
 	slog.Info("authenticating with Slack")
 	authResp, err := g.api.AuthTest()
@@ -50,43 +77,30 @@ func (g *Gateway) Run(ctx context.Context, handler func(msg Message)) {
 	g.botID = authResp.UserID
 	slog.Info("slack authenticated", "bot_user", authResp.User, "bot_id", g.botID, "team", authResp.Team)
 
-	smHandler := socketmode.NewSocketmodeHandler(g.socket)
-
-	smHandler.HandleEvents(slackevents.AppMention, func(evt *socketmode.Event, client *socketmode.Client) {
-		eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
-		if !ok {
-			slog.Warn("unexpected event data type", "type", fmt.Sprintf("%T", evt.Data))
-			return
-		}
-		client.Ack(*evt.Request)
-
-		ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.AppMentionEvent)
-		if !ok {
-			slog.Warn("unexpected inner event type", "type", fmt.Sprintf("%T", eventsAPIEvent.InnerEvent.Data))
-			return
+	pool := newWorkerPool(g.cfg.Workers, g.cfg.MaxQueueDepth, handler)
+	pool.onQueued = func(msg Message, position int) {
+		text := fmt.Sprintf("You're in the queue (position %d). I'll start as soon as I'm free.", position)
+		if err := g.PostMessage(msg.Channel, msg.ThreadTS, text); err != nil {
+			slog.Error("failed to send queue position", "error", err, "thread", msg.ThreadTS)
 		}
+	}
+	pool.start()
+	defer pool.stop()
+	g.pool.Store(pool)
+	defer g.pool.Store(nil)
+	slog.Info("worker pool started", "workers", pool.workers, "max_queue_depth", pool.maxDepth)
+	go logDuplicateEvents(ctx)
 
-		threadTS := ev.ThreadTimeStamp
-		if threadTS == "" {
-			threadTS = ev.TimeStamp
-		}
+	smHandler := socketmode.NewSocketmodeHandler(g.socket)
 
-		text := stripBotMention(ev.Text, g.botID)
-
-		slog.Debug("app mention received",
-			"user", ev.User,
-			"channel", ev.Channel,
-			"thread", threadTS,
-			"text", text,
-		)
-
-		handler(Message{
-			Channel:  ev.Channel,
-			ThreadTS: threadTS,
-			UserID:   ev.User,
-			Text:     text,
-		})
+	smHandler.HandleEvents(slackevents.AppMention, func(evt *socketmode.Event, client *socketmode.Client) {
+		g.handleMention(evt, client, pool)
+	})
+	smHandler.HandleEvents(slackevents.Message, func(evt *socketmode.Event, client *socketmode.Client) {
+		g.handleMessage(evt, client, pool)
 	})
+	smHandler.HandleEvents(slackevents.ReactionAdded, g.handleCancelReaction)
+	smHandler.HandleInteractionBlockAction(cancelActionID, g.handleCancelButton)
 
 	slog.Info("starting socket mode event loop")
 
@@ -102,37 +116,135 @@ func (g *Gateway) Run(ctx context.Context, handler func(msg Message)) {
 	slog.Info("slack gateway stopped")
 }
 
+func (g *Gateway) handleMention(evt *socketmode.Event, client *socketmode.Client, pool *workerPool) {
+	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		slog.Warn("unexpected event data type", "type", fmt.Sprintf("%T", evt.Data))
+		return
+	}
+	client.Ack(*evt.Request)
+
+	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.AppMentionEvent)
+	if !ok {
+		slog.Warn("unexpected inner event type", "type", fmt.Sprintf("%T", eventsAPIEvent.InnerEvent.Data))
+		return
+	}
+
+	threadTS := ev.ThreadTimeStamp
+	if threadTS == "" {
+		threadTS = ev.TimeStamp
+	}
+	msg := Message{
+		Channel:  ev.Channel,
+		ThreadTS: threadTS,
+		TS:       ev.TimeStamp,
+		UserID:   ev.User,
+		Text:     stripBotMention(ev.Text, g.botID),
+	}
+	if !g.triggersFor(ev.Channel).mentions && !isStopCommand(msg.Text) {
+		slog.Debug("mention ignored, trigger disabled", "channel", ev.Channel, "user", ev.User)
+		return
+	}
+
+	g.accept(evt, callbackEventID(eventsAPIEvent), ev.TimeStamp, msg, false, pool)
+}
+
+// PostMessage posts Markdown to a thread as Block Kit messages. Long text is
+// split across several messages or attached as a file; see postReport.
 func (g *Gateway) PostMessage(channel, threadTS, text string) error {
-	_, _, err := g.api.PostMessage(
+	return g.postReport(channel, threadTS, text)
+}
+
+// Submit queues msg for investigation as if it had arrived from Slack,
+// without checking triggers or access rules. It fails when Run is not active
+// or the queue is full; nothing is posted to the thread in that case.
+func (g *Gateway) Submit(msg Message) error {
+	pool := g.pool.Load()
+	if pool == nil {
+		return errors.New("slack gateway is not running")
+	}
+	if msg.TS == "" {
+		msg.TS = msg.ThreadTS
+	}
+	if err := pool.submit(msg); err != nil {
+		return err
+	}
+	g.threads.join(threadKey(msg))
+	return nil
+}
+
+// StartThread posts Markdown as a new top-level message and returns its
+// timestamp, to be used as the thread of follow-up messages.
+func (g *Gateway) StartThread(channel, text string) (string, error) {
+	return g.postMarkdown(channel, "", text)
+}
+
+// EditMessage replaces the content of a message with Markdown.
+func (g *Gateway) EditMessage(channel, ts, text string) error {
+	return g.updateBlocks(channel, ts, renderMrkdwn(text), renderBlocks(text)...)
+}
+
+// postMarkdown posts Markdown as a single message, with the same content as
+// mrkdwn text for notifications, and returns its timestamp.
+func (g *Gateway) postMarkdown(channel, threadTS, text string) (string, error) {
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(renderMrkdwn(text), false),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	if blocks := renderBlocks(text); len(blocks) <= maxBlocksPerMessage {
+		opts = append(opts, slack.MsgOptionBlocks(blocks...))
+	}
+	_, ts, err := g.api.PostMessage(channel, opts...)
+	if err != nil {
+		return "", fmt.Errorf("posting message: %w", err)
+	}
+	return ts, nil
+}
+
+// postBlocks posts a Block Kit message with a plain-text fallback and returns
+// the message timestamp.
+func (g *Gateway) postBlocks(channel, threadTS, fallback string, blocks ...slack.Block) (string, error) {
+	_, ts, err := g.api.PostMessage(
 		channel,
-		slack.MsgOptionText(mdToMrkdwn(text), false),
+		slack.MsgOptionText(fallback, false),
+		slack.MsgOptionBlocks(blocks...),
 		slack.MsgOptionTS(threadTS),
 	)
 	if err != nil {
-		return fmt.Errorf("posting message: %w", err)
+		return "", fmt.Errorf("posting message: %w", err)
+	}
+	return ts, nil
+}
+
+// updateBlocks replaces the content of an existing message.
+func (g *Gateway) updateBlocks(channel, ts, fallback string, blocks ...slack.Block) error {
+	_, _, _, err := g.api.UpdateMessage(
+		channel,
+		ts,
+		slack.MsgOptionText(fallback, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	if err != nil {
+		return fmt.Errorf("updating message: %w", err)
 	}
 	return nil
 }
 
+func eventKey(eventID string) string {
+	if eventID == "" {
+		return ""
+	}
+	return "event:" + eventID
+}
+
+func messageKey(channel, ts string) string {
+	return "message:" + channel + "/" + ts
+}
+
 func stripBotMention(text, botID string) string {
 	mention := fmt.Sprintf("<@%s>", botID)
 	text = strings.Replace(text, mention, "", 1)
 	return strings.TrimSpace(text)
 }
-
-var (
-	headerRe = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
-	boldRe   = regexp.MustCompile(`\*\*(.+?)\*\*`)
-	linkRe   = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
-)
-
-// mdToMrkdwn converts common Markdown patterns to Slack mrkdwn format.
-func mdToMrkdwn(text string) string {
-	// ## Header → *Header*
-	text = headerRe.ReplaceAllString(text, "*$1*")
-	// **bold** → *bold*
-	text = boldRe.ReplaceAllString(text, "*$1*")
-	// [text](url) → <url|text>
-	text = linkRe.ReplaceAllString(text, "<$2|$1>")
-	return text
-}
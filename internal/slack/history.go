@@ -0,0 +1,184 @@
+package slack
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	defaultHistoryMessages = 50
+	defaultHistoryChars    = 8000
+	historyPageSize        = 200
+)
+
+var userMentionRe = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^>]*)?>`)
+
+// ThreadMessage is a message posted in a thread before the current request.
+type ThreadMessage struct {
+	UserID string
+	Author string
+	Text   string
+	Time   time.Time
+}
+
+// ThreadHistory returns the messages posted in msg's thread before msg, newest
+// last, bounded by the configured message and character limits. It returns
+// nil for messages that start a thread or when the import is disabled.
+func (g *Gateway) ThreadHistory(msg Message) ([]ThreadMessage, error) {
+	cfg := g.cfg.ThreadHistory
+	if cfg.Disabled || msg.TS == "" || msg.TS == msg.ThreadTS {
+		return nil, nil
+	}
+	maxMessages := cmp.Or(cfg.MaxMessages, defaultHistoryMessages)
+	maxChars := cmp.Or(cfg.MaxChars, defaultHistoryChars)
+
+	// Replies come oldest first, so page through the whole thread and keep
+	// the thread's first message and the newest maxMessages before msg.
+	var parent *slack.Message
+	recent := make([]slack.Message, 0, maxMessages)
+	fetched := 0
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: msg.Channel,
+		Timestamp: msg.ThreadTS,
+		Latest:    msg.TS,
+		Limit:     historyPageSize,
+	}
+	for {
+		page, hasMore, cursor, err := g.api.GetConversationReplies(params)
+		if err != nil {
+			return nil, fmt.Errorf("fetching thread replies: %w", err)
+		}
+		fetched += len(page)
+		for _, reply := range page {
+			switch {
+			case !isHistoryMessage(reply, msg.TS):
+			case reply.Timestamp == msg.ThreadTS:
+				if parent == nil {
+					parent = &reply
+				}
+			default:
+				if len(recent) == maxMessages {
+					recent = append(recent[:0], recent[1:]...)
+				}
+				recent = append(recent, reply)
+			}
+		}
+		if !hasMore || cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	if parent != nil {
+		recent = append([]slack.Message{*parent}, recent...)
+	}
+
+	var history []ThreadMessage
+	chars := 0
+	for i := len(recent) - 1; i >= 0 && len(history) < maxMessages; i-- {
+		reply := recent[i]
+		text := strings.TrimSpace(g.resolveMentions(reply.Text))
+		if chars+len(text) > maxChars {
+			if len(history) > 0 {
+				break
+			}
+			text = truncateRunes(text, maxChars)
+		}
+		chars += len(text)
+		history = append(history, ThreadMessage{
+			UserID: reply.User,
+			Author: g.authorName(reply),
+			Text:   text,
+			Time:   parseTimestamp(reply.Timestamp),
+		})
+	}
+	slices.Reverse(history)
+
+	slog.Info("thread history imported", "thread", msg.ThreadTS, "messages", len(history), "chars", chars, "fetched", fetched)
+	return history, nil
+}
+
+// isHistoryMessage reports whether a thread reply is worth importing: not the
+// request itself, not a join or other system message, and not empty.
+func isHistoryMessage(m slack.Message, requestTS string) bool {
+	if m.Timestamp == requestTS || (m.SubType != "" && m.SubType != "bot_message" && m.SubType != "thread_broadcast") {
+		return false
+	}
+	return strings.TrimSpace(m.Text) != ""
+}
+
+func (g *Gateway) authorName(m slack.Message) string {
+	switch {
+	case m.User != "" && m.User == g.botID:
+		return "incidently (this bot)"
+	case m.User != "":
+		return g.userName(m.User)
+	case m.BotProfile != nil && m.BotProfile.Name != "":
+		return m.BotProfile.Name + " (bot)"
+	case m.Username != "":
+		return m.Username + " (bot)"
+	}
+	return "unknown"
+}
+
+// resolveMentions replaces user mentions with @display-name.
+func (g *Gateway) resolveMentions(text string) string {
+	return userMentionRe.ReplaceAllStringFunc(text, func(mention string) string {
+		return "@" + g.userName(userMentionRe.FindStringSubmatch(mention)[1])
+	})
+}
+
+// userName returns the user's display name, falling back to the real name,
+// the handle and finally the ID. Names are cached for the gateway's lifetime.
+func (g *Gateway) userName(userID string) string {
+	if name, ok := g.users.get(userID); ok {
+		return name
+	}
+	user, err := g.api.GetUserInfo(userID)
+	if err != nil {
+		slog.Warn("failed to look up slack user", "error", err, "user", userID)
+		return userID
+	}
+	name := cmp.Or(user.Profile.DisplayName, user.RealName, user.Name, userID)
+	g.users.set(userID, name)
+	return name
+}
+
+type userNames struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func newUserNames() *userNames {
+	return &userNames{names: make(map[string]string)}
+}
+
+func (u *userNames) get(userID string) (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	name, ok := u.names[userID]
+	return name, ok
+}
+
+func (u *userNames) set(userID, name string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.names[userID] = name
+}
+
+func parseTimestamp(ts string) time.Time {
+	sec, _, _ := strings.Cut(ts, ".")
+	n, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(n, 0).UTC()
+}
@@ -0,0 +1,103 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/illenko/incidently/internal/config"
+	"github.com/slack-go/slack"
+)
+
+// fakeReplies serves conversations.replies for a thread of n replies after
+// the parent, in pages of pageSize. Like Slack, every page starts with the
+// parent message.
+func fakeReplies(t *testing.T, n, pageSize int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		start, _ := strconv.Atoi(r.Form.Get("cursor"))
+		end := min(start+pageSize, n)
+
+		messages := []slack.Message{threadReply(0, "incident started")}
+		for i := start + 1; i <= end; i++ {
+			messages = append(messages, threadReply(i, fmt.Sprintf("reply %d", i)))
+		}
+		resp := map[string]any{"ok": true, "messages": messages, "has_more": end < n}
+		if end < n {
+			resp["response_metadata"] = map[string]string{"next_cursor": strconv.Itoa(end)}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func threadReply(i int, text string) slack.Message {
+	var m slack.Message
+	m.Timestamp = fmt.Sprintf("%d.000100", 1000+i)
+	m.User = "U1"
+	m.Text = text
+	return m
+}
+
+func TestThreadHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		replies     int
+		maxMessages int
+		want        []string
+	}{
+		{
+			name:        "short thread includes the first message",
+			replies:     2,
+			maxMessages: 10,
+			want:        []string{"incident started", "reply 1", "reply 2"},
+		},
+		{
+			name:        "long thread keeps the newest messages across pages",
+			replies:     450,
+			maxMessages: 3,
+			want:        []string{"reply 448", "reply 449", "reply 450"},
+		},
+		{
+			name:        "first message is kept once when there is room",
+			replies:     5,
+			maxMessages: 10,
+			want:        []string{"incident started", "reply 1", "reply 2", "reply 3", "reply 4", "reply 5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeReplies(t, tt.replies, 2)
+			defer srv.Close()
+
+			g := &Gateway{
+				api:   slack.New("token", slack.OptionAPIURL(srv.URL+"/")),
+				cfg:   config.SlackConfig{ThreadHistory: config.ThreadHistoryConfig{MaxMessages: tt.maxMessages}},
+				users: newUserNames(),
+			}
+			g.users.set("U1", "alice")
+
+			history, err := g.ThreadHistory(Message{
+				Channel:  "C1",
+				ThreadTS: threadReply(0, "").Timestamp,
+				TS:       threadReply(tt.replies+1, "").Timestamp,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range history {
+				got = append(got, m.Text)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package slack
+
+import (
+	"cmp"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+// mdBlockKind identifies a block-level Markdown construct.
+type mdBlockKind int
+
+const (
+	mdParagraph mdBlockKind = iota
+	mdHeading
+	mdRule
+	mdCode
+	mdTable
+	mdList
+	mdQuote
+)
+
+// mdBlock is one block-level element of a Markdown document.
+type mdBlock struct {
+	kind  mdBlockKind
+	level int          // heading level
+	text  string       // paragraph, heading, quote and code text
+	lang  string       // code fence language
+	rows  [][]string   // table cells, header row first
+	items []mdListItem // list items in document order
+	src   string       // source lines the block was parsed from
+}
+
+type mdListItem struct {
+	level   int
+	ordered bool
+	number  int
+	text    string
+}
+
+var (
+	mdHeadingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRuleRe     = regexp.MustCompile(`^(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	mdListItemRe = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	mdTableSepRe = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+)
+
+// parseMarkdown splits Markdown into block-level elements. It covers the
+// subset agents produce: ATX headings, paragraphs, fenced code, pipe tables,
+// nested lists, block quotes and horizontal rules.
+func parseMarkdown(src string) []mdBlock {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var blocks []mdBlock
+	for i := 0; i < len(lines); {
+		start, parsed := i, len(blocks)
+		trimmed := strings.TrimSpace(lines[i])
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case isFence(trimmed):
+			block, next := parseFence(lines, i)
+			blocks = append(blocks, block)
+			i = next
+
+		case mdHeadingRe.MatchString(trimmed):
+			m := mdHeadingRe.FindStringSubmatch(trimmed)
+			blocks = append(blocks, mdBlock{kind: mdHeading, level: len(m[1]), text: m[2]})
+			i++
+
+		case mdRuleRe.MatchString(trimmed):
+			blocks = append(blocks, mdBlock{kind: mdRule})
+			i++
+
+		case isTableStart(lines, i):
+			block, next := parseTable(lines, i)
+			blocks = append(blocks, block)
+			i = next
+
+		case mdListItemRe.MatchString(lines[i]):
+			block, next := parseList(lines, i)
+			blocks = append(blocks, block)
+			i = next
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if !strings.HasPrefix(t, ">") {
+					break
+				}
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(t, ">")))
+			}
+			blocks = append(blocks, mdBlock{kind: mdQuote, text: strings.Join(quote, "\n")})
+
+		default:
+			var para []string
+			for ; i < len(lines); i++ {
+				if strings.TrimSpace(lines[i]) == "" || (len(para) > 0 && startsBlock(lines, i)) {
+					break
+				}
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, mdBlock{kind: mdParagraph, text: strings.Join(para, "\n")})
+		}
+
+		if len(blocks) > parsed {
+			blocks[parsed].src = strings.TrimRight(strings.Join(lines[start:i], "\n"), "\n ")
+		}
+	}
+	return blocks
+}
+
+func startsBlock(lines []string, i int) bool {
+	trimmed := strings.TrimSpace(lines[i])
+	return isFence(trimmed) ||
+		mdHeadingRe.MatchString(trimmed) ||
+		mdRuleRe.MatchString(trimmed) ||
+		mdListItemRe.MatchString(lines[i]) ||
+		strings.HasPrefix(trimmed, ">") ||
+		isTableStart(lines, i)
+}
+
+func isFence(trimmed string) bool {
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
+
+// parseFence reads a fenced code block. An unterminated fence runs to the end
+// of the document.
+func parseFence(lines []string, start int) (mdBlock, int) {
+	opening := strings.TrimSpace(lines[start])
+	fence := opening[:3]
+	lang := strings.TrimSpace(strings.TrimLeft(opening, fence[:1]))
+
+	var body []string
+	i := start + 1
+	closed := false
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+			i++
+			closed = true
+			break
+		}
+		body = append(body, lines[i])
+	}
+	// An unterminated fence runs to the end of the report; drop the blank
+	// lines it picked up there.
+	for !closed && len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+	return mdBlock{kind: mdCode, lang: lang, text: strings.Join(body, "\n")}, i
+}
+
+func isTableStart(lines []string, i int) bool {
+	if i+1 >= len(lines) {
+		return false
+	}
+	header := strings.TrimSpace(lines[i])
+	sep := strings.TrimSpace(lines[i+1])
+	return strings.Contains(header, "|") && strings.Contains(sep, "-") && mdTableSepRe.MatchString(sep)
+}
+
+func parseTable(lines []string, start int) (mdBlock, int) {
+	rows := [][]string{splitTableRow(lines[start])}
+	i := start + 2
+	for ; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if t == "" || !strings.Contains(t, "|") {
+			break
+		}
+		rows = append(rows, splitTableRow(t))
+	}
+	return mdBlock{kind: mdTable, rows: rows}, i
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseList reads consecutive list items, tracking nesting by indentation.
+// Indented lines that are not items continue the previous item.
+func parseList(lines []string, start int) (mdBlock, int) {
+	var items []mdListItem
+	var indents []int
+
+	i := start
+	for i < len(lines) {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			next := i + 1
+			for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+				next++
+			}
+			if next < len(lines) && mdListItemRe.MatchString(lines[next]) {
+				i = next
+				continue
+			}
+			break
+		}
+
+		m := mdListItemRe.FindStringSubmatch(line)
+		if m == nil {
+			if len(items) == 0 || (!strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") && startsBlock(lines, i)) {
+				break
+			}
+			last := &items[len(items)-1]
+			last.text += "\n" + strings.TrimSpace(line)
+			i++
+			continue
+		}
+
+		indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+		for len(indents) > 0 && indents[len(indents)-1] > indent {
+			indents = indents[:len(indents)-1]
+		}
+		if len(indents) == 0 || indents[len(indents)-1] < indent {
+			indents = append(indents, indent)
+		}
+
+		item := mdListItem{level: len(indents) - 1, text: m[3]}
+		if n, err := strconv.Atoi(strings.TrimRight(m[2], ".)")); err == nil {
+			item.ordered = true
+			item.number = n
+		}
+		items = append(items, item)
+		i++
+	}
+	return mdBlock{kind: mdList, items: items}, i
+}
+
+// spanKind identifies an inline Markdown element.
+type spanKind int
+
+const (
+	spanText spanKind = iota
+	spanLink
+	spanEmoji
+	spanUser
+	spanChannel
+	spanBroadcast
+)
+
+// inlineSpan is a run of inline content with a single style. For links text is
+// the label and target the URL; for emoji, users, channels and broadcasts
+// target holds the name or ID.
+type inlineSpan struct {
+	kind   spanKind
+	text   string
+	target string
+	style  slack.RichTextSectionTextStyle
+}
+
+var (
+	mdLinkRe    = regexp.MustCompile(`^\[([^\]]+)\]\(([^)\s]+)\)`)
+	slackRefRe  = regexp.MustCompile(`^<([@#!][^>|]+|https?://[^>|]+)(?:\|([^>]*))?>`)
+	autoLinkRe  = regexp.MustCompile(`^<(https?://[^>\s]+)>`)
+	emojiCodeRe = regexp.MustCompile(`^:([a-z0-9_+'-]*[a-z][a-z0-9_+'-]*):`)
+)
+
+// parseInline splits inline Markdown into styled spans. It understands code,
+// bold, italic, strikethrough, links, :emoji: shortcodes and Slack references
+// such as <@U123> that the model may echo back.
+func parseInline(s string) []inlineSpan {
+	return appendInline(nil, s, slack.RichTextSectionTextStyle{})
+}
+
+func appendInline(spans []inlineSpan, s string, style slack.RichTextSectionTextStyle) []inlineSpan {
+	var buf strings.Builder
+	flush := func() {
+		if buf.Len() > 0 {
+			spans = append(spans, inlineSpan{kind: spanText, text: buf.String(), style: style})
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch c := rest[0]; {
+		case c == '\\' && len(rest) > 1 && strings.IndexByte("\\`*_~[]()<>#|:", rest[1]) >= 0:
+			buf.WriteByte(rest[1])
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				flush()
+				code := style
+				code.Code = true
+				spans = append(spans, inlineSpan{kind: spanText, text: rest[1 : 1+end], style: code})
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**"), strings.HasPrefix(rest, "__"), strings.HasPrefix(rest, "~~"):
+			delim := rest[:2]
+			end := strings.Index(rest[2:], delim)
+			if end > 0 && (delim != "__" || wordBoundary(s, i, i+end+4)) {
+				flush()
+				inner := style
+				if delim == "~~" {
+					inner.Strike = true
+				} else {
+					inner.Bold = true
+				}
+				spans = appendInline(spans, rest[2:2+end], inner)
+				i += end + 4
+				continue
+			}
+
+		case c == '*', c == '_':
+			end := strings.IndexByte(rest[1:], c)
+			if end > 0 && rest[1] != ' ' && rest[end] != ' ' && (c == '*' || wordBoundary(s, i, i+end+2)) {
+				flush()
+				inner := style
+				inner.Italic = true
+				spans = appendInline(spans, rest[1:1+end], inner)
+				i += end + 2
+				continue
+			}
+
+		case c == '[':
+			if m := mdLinkRe.FindStringSubmatch(rest); m != nil {
+				flush()
+				spans = append(spans, inlineSpan{kind: spanLink, text: m[1], target: m[2], style: style})
+				i += len(m[0])
+				continue
+			}
+
+		case c == '<':
+			if m := autoLinkRe.FindStringSubmatch(rest); m != nil {
+				flush()
+				spans = append(spans, inlineSpan{kind: spanLink, target: m[1], style: style})
+				i += len(m[0])
+				continue
+			}
+			if m := slackRefRe.FindStringSubmatch(rest); m != nil {
+				flush()
+				spans = append(spans, slackRefSpan(m[1], m[2], style))
+				i += len(m[0])
+				continue
+			}
+
+		case c == ':':
+			if m := emojiCodeRe.FindStringSubmatch(rest); m != nil {
+				flush()
+				spans = append(spans, inlineSpan{kind: spanEmoji, target: m[1]})
+				i += len(m[0])
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		buf.WriteRune(r)
+		i += size
+	}
+	flush()
+	return spans
+}
+
+func slackRefSpan(ref, label string, style slack.RichTextSectionTextStyle) inlineSpan {
+	switch ref[0] {
+	case '@':
+		return inlineSpan{kind: spanUser, target: ref[1:]}
+	case '#':
+		return inlineSpan{kind: spanChannel, target: ref[1:], text: label}
+	case '!':
+		return inlineSpan{kind: spanBroadcast, target: ref[1:]}
+	default:
+		return inlineSpan{kind: spanLink, text: label, target: ref, style: style}
+	}
+}
+
+// wordBoundary reports whether s[start:end] is not embedded in a word, so that
+// snake_case identifiers are not mistaken for emphasis.
+func wordBoundary(s string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(s[:start]); isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		if r, _ := utf8.DecodeRuneInString(s[end:]); isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// plainText renders spans without styling, for plain_text fields and tables.
+func plainText(spans []inlineSpan) string {
+	var b strings.Builder
+	for _, sp := range spans {
+		switch sp.kind {
+		case spanEmoji:
+			b.WriteString(":" + sp.target + ":")
+		case spanUser:
+			b.WriteString("@" + sp.target)
+		case spanChannel:
+			b.WriteString("#" + cmp.Or(sp.text, sp.target))
+		case spanBroadcast:
+			b.WriteString("@" + sp.target)
+		case spanLink:
+			b.WriteString(cmp.Or(sp.text, sp.target))
+		default:
+			b.WriteString(sp.text)
+		}
+	}
+	return b.String()
+}
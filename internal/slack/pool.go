@@ -0,0 +1,197 @@
+package slack
+
+import (
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	defaultWorkers       = 4
+	defaultMaxQueueDepth = 20
+)
+
+var (
+	errQueueFull  = errors.New("too many requests queued")
+	errPoolClosed = errors.New("worker pool is stopped")
+)
+
+// workerPool runs message handlers on a bounded number of goroutines.
+// Messages from the same thread are serialized: a message waits until the
+// previous one in its thread has finished, so a session is never used by two
+// investigations at once.
+type workerPool struct {
+	handler  func(Message)
+	maxDepth int
+
+	// onQueued is called when all workers are busy and a message has to wait
+	// for one, with its 1-based position among the messages waiting for a
+	// worker. It is not called for messages waiting behind their own thread.
+	// It runs on its own goroutine, so submit never waits for Slack.
+	onQueued func(msg Message, position int)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []Message
+	threads map[string][]Message // threads with a queued or running message -> messages waiting behind it
+	waiting int                  // messages in ready or a thread backlog, bounded by maxDepth
+	active  int
+	workers int
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+func newWorkerPool(workers, maxDepth int, handler func(Message)) *workerPool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxQueueDepth
+	}
+	p := &workerPool{
+		handler:  handler,
+		maxDepth: maxDepth,
+		onQueued: func(Message, int) {},
+		threads:  make(map[string][]Message),
+		workers:  workers,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *workerPool) start() {
+	for range p.workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+// submit enqueues a message. It never blocks the caller, and fails with
+// errQueueFull when maxDepth messages are already waiting.
+func (p *workerPool) submit(msg Message) error {
+	key := threadKey(msg)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errPoolClosed
+	}
+	if p.waiting >= p.maxDepth {
+		p.mu.Unlock()
+		slog.Warn("queue full, rejecting message", "thread", msg.ThreadTS, "depth", p.maxDepth)
+		return errQueueFull
+	}
+
+	p.waiting++
+	position := 0
+	if backlog, busy := p.threads[key]; busy {
+		p.threads[key] = append(backlog, msg)
+	} else {
+		p.threads[key] = nil
+		p.ready = append(p.ready, msg)
+		// Idle workers take ready messages right away; only those beyond
+		// them wait for a worker.
+		position = p.active + len(p.ready) - p.workers
+		p.cond.Signal()
+	}
+	p.mu.Unlock()
+
+	if position > 0 {
+		slog.Info("message queued", "thread", msg.ThreadTS, "position", position)
+		go p.onQueued(msg, position)
+	}
+	return nil
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.ready) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.ready) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		msg := p.ready[0]
+		p.ready = p.ready[1:]
+		p.waiting--
+		p.active++
+		p.mu.Unlock()
+
+		p.run(msg)
+
+		key := threadKey(msg)
+		p.mu.Lock()
+		p.active--
+		if backlog := p.threads[key]; len(backlog) > 0 {
+			p.ready = append(p.ready, backlog[0])
+			p.threads[key] = backlog[1:]
+			p.cond.Signal()
+		} else {
+			delete(p.threads, key)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *workerPool) run(msg Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("message handler panicked", "panic", r, "thread", msg.ThreadTS, "stack", string(debug.Stack()))
+		}
+	}()
+	p.handler(msg)
+}
+
+// stop lets workers finish queued messages and waits for them to exit.
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// intake runs the Slack lookups that decide whether a message is accepted off
+// the socket mode event loop, which handles events one at a time. Work for
+// the same thread runs in arrival order, so messages reach the pool in the
+// order they were sent; different threads proceed independently.
+type intake struct {
+	mu   sync.Mutex
+	last map[string]chan struct{} // thread -> done channel of its latest work
+}
+
+func newIntake() *intake {
+	return &intake{last: make(map[string]chan struct{})}
+}
+
+// run calls f on a new goroutine once earlier work for key has finished.
+func (in *intake) run(key string, f func()) {
+	done := make(chan struct{})
+	in.mu.Lock()
+	prev := in.last[key]
+	in.last[key] = done
+	in.mu.Unlock()
+
+	go func() {
+		defer func() {
+			in.mu.Lock()
+			if in.last[key] == done {
+				delete(in.last, key)
+			}
+			in.mu.Unlock()
+			close(done)
+		}()
+		if prev != nil {
+			<-prev
+		}
+		f()
+	}()
+}
+
+func threadKey(msg Message) string {
+	return msg.Channel + "/" + msg.ThreadTS
+}
@@ -0,0 +1,258 @@
+package slack
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/agent"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// progressUpdateInterval is the minimum time between chat.update calls.
+	progressUpdateInterval = 3 * time.Second
+	// progressRefreshInterval refreshes the elapsed time even without new steps.
+	progressRefreshInterval = 15 * time.Second
+)
+
+// ProgressReporter keeps a single status message in a thread up to date while
+// an investigation runs, instead of posting a new message per step. Updates
+// are coalesced and sent at most once per progressUpdateInterval.
+type ProgressReporter struct {
+	gw       *Gateway
+	channel  string
+	threadTS string
+
+	mu         sync.Mutex
+	ts         string
+	started    time.Time
+	agent      string
+	agents     []string
+	toolCounts map[string]int
+	toolOrder  []string
+	toolErrors int
+	tokens     int64
+	dirty      bool
+	lastUpdate time.Time
+	finished   bool
+
+	done    chan struct{} // closed to stop the update loop
+	stopped chan struct{} // closed when the update loop has exited
+}
+
+// NewProgressReporter creates a reporter for a thread. Call Start to post the
+// status message and Finish or Fail when the investigation ends.
+func (g *Gateway) NewProgressReporter(channel, threadTS string) *ProgressReporter {
+	return &ProgressReporter{
+		gw:         g,
+		channel:    channel,
+		threadTS:   threadTS,
+		toolCounts: make(map[string]int),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Start posts the initial status message and begins periodic updates.
+func (r *ProgressReporter) Start() error {
+	r.mu.Lock()
+	r.started = time.Now()
+	r.lastUpdate = r.started
+	text := r.renderLocked()
+	r.mu.Unlock()
+
+	ts, err := r.gw.postBlocks(r.channel, r.threadTS, text, r.blocks(text, true)...)
+	if err != nil {
+		return fmt.Errorf("posting status message: %w", err)
+	}
+	r.gw.trackStatusMessage(r.channel, ts, r.key())
+
+	r.mu.Lock()
+	r.ts = ts
+	r.mu.Unlock()
+
+	go r.loop()
+	return nil
+}
+
+// HandleEvent updates the status message from an investigation event.
+func (r *ProgressReporter) HandleEvent(e agent.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch e.Kind {
+	case agent.EventTransfer:
+		r.setAgentLocked(e.TransferTo)
+	case agent.EventToolStarted:
+		r.setAgentLocked(e.Agent)
+		if r.toolCounts[e.Tool] == 0 {
+			r.toolOrder = append(r.toolOrder, e.Tool)
+		}
+		r.toolCounts[e.Tool]++
+	case agent.EventToolFailed:
+		r.toolErrors++
+	case agent.EventUsage:
+		// Token usage only shows in the final summary.
+		r.tokens += int64(e.Usage.TotalTokens)
+		return
+	default:
+		return
+	}
+	r.dirty = true
+}
+
+// setAgentLocked records the agent currently working.
+func (r *ProgressReporter) setAgentLocked(name string) {
+	if name == "" || name == r.agent {
+		return
+	}
+	r.agent = name
+	if !slices.Contains(r.agents, name) {
+		r.agents = append(r.agents, name)
+	}
+}
+
+// Finish turns the status message into a short completion summary.
+func (r *ProgressReporter) Finish() {
+	r.finish(":white_check_mark: Investigation finished")
+}
+
+// Fail turns the status message into a failure summary.
+func (r *ProgressReporter) Fail() {
+	r.finish(":x: Investigation failed")
+}
+
+// Cancelled turns the status message into a note that userID stopped it.
+func (r *ProgressReporter) Cancelled(userID string) {
+	r.finish(fmt.Sprintf(":octagonal_sign: Investigation stopped by <@%s>", userID))
+}
+
+func (r *ProgressReporter) finish(headline string) {
+	r.mu.Lock()
+	if r.finished {
+		r.mu.Unlock()
+		return
+	}
+	r.finished = true
+	ts := r.ts
+	text := fmt.Sprintf("%s in %s", headline, formatElapsed(time.Since(r.started)))
+	if summary := r.summaryLocked(); summary != "" {
+		text += " · " + summary
+	}
+	r.mu.Unlock()
+
+	if ts == "" {
+		return
+	}
+	// Wait for an in-flight periodic update so it cannot overwrite the summary.
+	close(r.done)
+	<-r.stopped
+	if err := r.gw.updateBlocks(r.channel, ts, text, r.blocks(text, false)...); err != nil {
+		slog.Error("failed to finalize status message", "error", err, "thread", r.threadTS)
+	}
+}
+
+func (r *ProgressReporter) loop() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(progressUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		due := r.dirty || time.Since(r.lastUpdate) >= progressRefreshInterval
+		if !due || r.finished {
+			r.mu.Unlock()
+			continue
+		}
+		text := r.renderLocked()
+		r.dirty = false
+		r.lastUpdate = time.Now()
+		r.mu.Unlock()
+
+		slog.Debug("updating status message", "thread", r.threadTS)
+		if err := r.gw.updateBlocks(r.channel, r.ts, text, r.blocks(text, true)...); err != nil {
+			slog.Error("failed to update status message", "error", err, "thread", r.threadTS)
+		}
+	}
+}
+
+// blocks renders the status text, with a stop button while the investigation
+// is still running. Reacting with :x: on the message also stops it.
+func (r *ProgressReporter) blocks(text string, running bool) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}
+	if running {
+		stop := slack.NewButtonBlockElement(cancelActionID, r.key(),
+			slack.NewTextBlockObject(slack.PlainTextType, "Stop", false, false))
+		stop.Style = slack.StyleDanger
+		blocks = append(blocks, slack.NewActionBlock("", stop))
+	}
+	return blocks
+}
+
+func (r *ProgressReporter) key() string {
+	return threadKey(Message{Channel: r.channel, ThreadTS: r.threadTS})
+}
+
+func (r *ProgressReporter) renderLocked() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ":hourglass_flowing_sand: Investigating... (%s)", formatElapsed(time.Since(r.started)))
+	if r.agent != "" {
+		fmt.Fprintf(&b, "\nCurrent agent: *%s*", r.agent)
+	}
+	if len(r.toolOrder) > 0 {
+		tools := make([]string, 0, len(r.toolOrder))
+		for _, name := range r.toolOrder {
+			if n := r.toolCounts[name]; n > 1 {
+				tools = append(tools, fmt.Sprintf("`%s` ×%d", name, n))
+			} else {
+				tools = append(tools, fmt.Sprintf("`%s`", name))
+			}
+		}
+		fmt.Fprintf(&b, "\nTools called: %s", strings.Join(tools, ", "))
+		if r.toolErrors > 0 {
+			fmt.Fprintf(&b, " (%d failed)", r.toolErrors)
+		}
+	}
+	b.WriteString("\n_React with :x: or reply `stop` to cancel._")
+	return b.String()
+}
+
+func (r *ProgressReporter) summaryLocked() string {
+	var parts []string
+	if len(r.agents) > 0 {
+		parts = append(parts, "agents: "+strings.Join(r.agents, ", "))
+	}
+	calls := 0
+	for _, n := range r.toolCounts {
+		calls += n
+	}
+	if calls > 0 {
+		parts = append(parts, fmt.Sprintf("%d tool calls", calls))
+	}
+	if r.toolErrors > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", r.toolErrors))
+	}
+	if r.tokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", r.tokens))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm %02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
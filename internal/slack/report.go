@@ -0,0 +1,224 @@
+package slack
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// maxMessageChars is the Markdown size of one message; Slack recommends
+	// keeping message text under 4,000 characters.
+	maxMessageChars            = 3900
+	defaultReportFileThreshold = 12000
+	reportFileName             = "report.md"
+)
+
+// postReport posts Markdown that does not fit in one message. Reports above
+// the configured threshold, or with a code block too large for one message,
+// are posted as a summary with the full report attached as a Markdown file;
+// shorter ones are split across messages.
+func (g *Gateway) postReport(channel, threadTS, report string) error {
+	threshold := cmp.Or(g.cfg.ReportFileThreshold, defaultReportFileThreshold)
+	if len(report) > threshold || hasOversizedCode(report, maxMessageChars) {
+		rest, err := g.postReportFile(channel, threadTS, report)
+		if err == nil {
+			return nil
+		}
+		slog.Error("failed to attach report, posting it in chunks", "error", err, "thread", threadTS)
+		report = rest
+	}
+
+	var messages []string
+	for _, chunk := range chunkMarkdown(report, maxMessageChars) {
+		if len(chunk) <= maxMessageChars {
+			messages = append(messages, chunk)
+			continue
+		}
+		// Only a code block too large for a message gets here, and only
+		// when the upload failed; splitting it beats losing it.
+		messages = append(messages, splitCode(parseMarkdown(chunk)[0], maxMessageChars)...)
+	}
+	for i, m := range messages {
+		if _, err := g.postMarkdown(channel, threadTS, m); err != nil {
+			return fmt.Errorf("posting part %d of %d: %w", i+1, len(messages), err)
+		}
+	}
+	return nil
+}
+
+// postReportFile posts the report's summary and uploads the full report. On
+// failure it returns what is left to post: the whole report if the summary
+// was not posted, the part after the summary otherwise.
+func (g *Gateway) postReportFile(channel, threadTS, report string) (string, error) {
+	summary, rest := reportSummary(report, maxMessageChars)
+	note := fmt.Sprintf("_Full report (%d characters) attached as `%s`._", len(report), reportFileName)
+	if summary != "" {
+		note = summary + "\n\n" + note
+	}
+	if _, err := g.postMarkdown(channel, threadTS, note); err != nil {
+		return report, err
+	}
+
+	_, err := g.api.UploadFileV2(slack.UploadFileV2Parameters{
+		Content:         report,
+		FileSize:        len(report),
+		Filename:        reportFileName,
+		Title:           "Full report",
+		SnippetType:     "markdown",
+		Channel:         channel,
+		ThreadTimestamp: threadTS,
+	})
+	if err != nil {
+		return rest, fmt.Errorf("uploading report: %w", err)
+	}
+	return "", nil
+}
+
+// reportSummary splits a report into its start and the rest. The start is
+// everything up to the second heading, so the title and first section, or
+// the first message-sized chunk if that is longer. The summary is empty if
+// the report opens with a code block too large for a message.
+func reportSummary(md string, limit int) (summary, rest string) {
+	var parts, after []string
+	headings, content := 0, false
+	for _, b := range parseMarkdown(md) {
+		if len(after) == 0 {
+			if b.kind == mdHeading {
+				headings++
+				if headings > 1 && content {
+					after = append(after, b.src)
+					continue
+				}
+			} else {
+				content = true
+			}
+			parts = append(parts, b.src)
+			continue
+		}
+		after = append(after, b.src)
+	}
+	summary = strings.Join(parts, "\n\n")
+	if len(summary) > limit {
+		chunks := chunkMarkdown(summary, limit)
+		if len(chunks[0]) > limit {
+			return "", strings.Join(append(chunks, after...), "\n\n")
+		}
+		summary = chunks[0]
+		after = append(chunks[1:], after...)
+	}
+	return summary, strings.Join(after, "\n\n")
+}
+
+// hasOversizedCode reports whether md has a code block larger than limit.
+func hasOversizedCode(md string, limit int) bool {
+	for _, b := range parseMarkdown(md) {
+		if b.kind == mdCode && len(b.src) > limit {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkMarkdown splits Markdown into pieces that each fit in one message,
+// breaking between blocks. Paragraphs, lists and tables larger than a
+// message are split at line boundaries, with the table header repeated. A
+// code block is never split; one larger than a message is a piece of its
+// own.
+func chunkMarkdown(md string, limit int) []string {
+	var chunks []string
+	var current []string
+	size, blocks := 0, 0
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n\n"))
+			current, size, blocks = nil, 0, 0
+		}
+	}
+
+	for _, b := range parseMarkdown(md) {
+		for _, piece := range splitBlock(b, limit) {
+			n := len(renderBlocks(piece))
+			if len(current) > 0 && (size+len(piece)+2 > limit || blocks+n > maxBlocksPerMessage) {
+				flush()
+			}
+			current = append(current, piece)
+			size += len(piece) + 2
+			blocks += n
+		}
+	}
+	flush()
+	return chunks
+}
+
+func splitBlock(b mdBlock, limit int) []string {
+	if len(b.src) <= limit {
+		return []string{b.src}
+	}
+	switch b.kind {
+	case mdCode:
+		return []string{b.src}
+	case mdTable:
+		return splitTable(b, limit)
+	default:
+		return splitText(b.src, limit)
+	}
+}
+
+// splitTable splits a table between rows, repeating the header in each piece.
+func splitTable(b mdBlock, limit int) []string {
+	lines := strings.Split(b.src, "\n")
+	header := strings.Join(lines[:2], "\n")
+	var pieces []string
+	piece := header
+	for _, row := range lines[2:] {
+		if len(piece)+len(row)+1 > limit && piece != header {
+			pieces = append(pieces, piece)
+			piece = header
+		}
+		piece += "\n" + row
+	}
+	return append(pieces, piece)
+}
+
+// splitCode splits a code block at line boundaries into fenced pieces of at
+// most limit bytes. Lines are kept intact, indentation included, unless a
+// single line does not fit.
+func splitCode(b mdBlock, limit int) []string {
+	opening, _, _ := strings.Cut(strings.TrimSpace(b.src), "\n")
+	closing := opening[:3]
+	if len(opening) > limit/4 {
+		// The info string is only a language hint; drop it rather than
+		// leave no room for the code.
+		opening = closing
+	}
+	budget := limit - len(opening) - len(closing) - 2
+
+	var pieces []string
+	var piece []string
+	size := 0
+	flush := func() {
+		if len(piece) > 0 {
+			pieces = append(pieces, opening+"\n"+strings.Join(piece, "\n")+"\n"+closing)
+			piece, size = nil, 0
+		}
+	}
+	for _, line := range strings.Split(b.text, "\n") {
+		parts := []string{line}
+		if len(line) > budget {
+			parts = splitText(line, budget)
+		}
+		for _, part := range parts {
+			if len(piece) > 0 && size+len(part)+1 > budget {
+				flush()
+			}
+			piece = append(piece, part)
+			size += len(part) + 1
+		}
+	}
+	flush()
+	return pieces
+}
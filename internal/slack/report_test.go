@@ -0,0 +1,147 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkMarkdown(t *testing.T) {
+	code := "```go\n" + strings.Repeat("fmt.Println(\"incident\")\n", 200) + "```"
+	tests := []struct {
+		name  string
+		input string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "blocks that fit share a message",
+			input: "# Title\n\nFirst.\n\nSecond.",
+			limit: 100,
+			want:  []string{"# Title\n\nFirst.\n\nSecond."},
+		},
+		{
+			name:  "breaks between blocks",
+			input: "First paragraph.\n\nSecond paragraph.",
+			limit: 20,
+			want:  []string{"First paragraph.", "Second paragraph."},
+		},
+		{
+			name:  "oversized code block is kept whole",
+			input: "Before.\n\n" + code + "\n\nAfter.",
+			limit: 1000,
+			want:  []string{"Before.", code, "After."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkMarkdown(tt.input, tt.limit)
+			if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+				t.Errorf("got %d chunks %q, want %d chunks %q", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCode(t *testing.T) {
+	body := strings.Repeat("line of output\n", 300)
+	tests := []struct {
+		name    string
+		opening string
+	}{
+		{name: "language", opening: "```text"},
+		// An info string longer than the limit used to leave a negative
+		// budget and panic.
+		{name: "info string longer than the limit", opening: "```" + strings.Repeat("x", 2*maxMessageChars)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := parseMarkdown(tt.opening + "\n" + body + "```")
+			pieces := splitCode(blocks[0], maxMessageChars)
+			if len(pieces) < 2 {
+				t.Fatalf("got %d pieces, want the block split", len(pieces))
+			}
+			var lines []string
+			for _, p := range pieces {
+				if len(p) > maxMessageChars {
+					t.Errorf("piece has %d bytes, limit is %d", len(p), maxMessageChars)
+				}
+				b := parseMarkdown(p)
+				if len(b) != 1 || b[0].kind != mdCode {
+					t.Fatalf("piece is not a single code block: %q", p)
+				}
+				lines = append(lines, b[0].text)
+			}
+			if got := strings.Join(lines, "\n"); got != strings.TrimSuffix(body, "\n") {
+				t.Errorf("pieces do not add up to the code block")
+			}
+		})
+	}
+}
+
+func TestReportSummary(t *testing.T) {
+	code := "```\n" + strings.Repeat("x\n", 100) + "```"
+	tests := []struct {
+		name        string
+		input       string
+		limit       int
+		wantSummary string
+		wantRest    string
+	}{
+		{
+			name:        "title and first section",
+			input:       "# Report\n\nFindings.\n\n## Details\n\nMore.",
+			limit:       100,
+			wantSummary: "# Report\n\nFindings.",
+			wantRest:    "## Details\n\nMore.",
+		},
+		{
+			name:        "long first section is cut to a message",
+			input:       "# Report\n\nFirst.\n\nSecond.\n\n## Details",
+			limit:       20,
+			wantSummary: "# Report\n\nFirst.",
+			wantRest:    "Second.\n\n## Details",
+		},
+		{
+			name:        "opening code block too large for a message",
+			input:       code + "\n\n## Details",
+			limit:       100,
+			wantSummary: "",
+			wantRest:    code + "\n\n## Details",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, rest := reportSummary(tt.input, tt.limit)
+			if summary != tt.wantSummary {
+				t.Errorf("summary = %q, want %q", summary, tt.wantSummary)
+			}
+			if rest != tt.wantRest {
+				t.Errorf("rest = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestHasOversizedCode(t *testing.T) {
+	long := "```\n" + strings.Repeat("x\n", 100) + "```"
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "short code block", input: "Text.\n\n```\nx\n```", want: false},
+		{name: "long paragraph", input: strings.Repeat("word ", 100), want: false},
+		{name: "long code block", input: "Text.\n\n" + long, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasOversizedCode(tt.input, 100); got != tt.want {
+				t.Errorf("hasOversizedCode = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package slack
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/incidently/internal/config"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+const (
+	// participationTTL is how long the bot keeps answering unmentioned replies
+	// in a thread after its last request there.
+	participationTTL = 24 * time.Hour
+	// nonParticipationTTL caches threads without the bot so busy human threads
+	// do not cost a conversations.replies call per message.
+	nonParticipationTTL = 5 * time.Minute
+	// threadLookupLimit bounds the replies fetched to find the bot in a thread.
+	threadLookupLimit = 200
+)
+
+// triggers are the kinds of messages the bot responds to in a channel.
+type triggers struct {
+	mentions       bool
+	directMessages bool
+	threadReplies  bool
+}
+
+func (g *Gateway) triggersFor(channel string) triggers {
+	t := triggers{mentions: true, directMessages: true}
+	apply := func(c config.TriggerConfig) {
+		if c.Mentions != nil {
+			t.mentions = *c.Mentions
+		}
+		if c.DirectMessages != nil {
+			t.directMessages = *c.DirectMessages
+		}
+		if c.ThreadReplies != nil {
+			t.threadReplies = *c.ThreadReplies
+		}
+	}
+	apply(g.cfg.Triggers)
+	if c, ok := g.cfg.ChannelTriggers[channel]; ok {
+		apply(c)
+	}
+	return t
+}
+
+// handleMessage handles message events: direct messages, unmentioned replies
+// in threads the bot takes part in, and "stop" replies. Messages that mention
+// the bot in a channel arrive as app_mention events and are ignored here.
+func (g *Gateway) handleMessage(evt *socketmode.Event, client *socketmode.Client, pool *workerPool) {
+	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		return
+	}
+	client.Ack(*evt.Request)
+
+	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.MessageEvent)
+	if !ok || ev.SubType != "" || ev.BotID != "" || ev.User == "" || ev.User == g.botID {
+		return
+	}
+
+	isDM := ev.ChannelType == "im"
+	if !isDM && (ev.ThreadTimeStamp == "" || strings.Contains(ev.Text, fmt.Sprintf("<@%s>", g.botID))) {
+		return
+	}
+
+	msg := Message{
+		Channel:  ev.Channel,
+		ThreadTS: ev.ThreadTimeStamp,
+		TS:       ev.TimeStamp,
+		UserID:   ev.User,
+		Text:     stripBotMention(ev.Text, g.botID),
+	}
+	trig := g.triggersFor(ev.Channel)
+
+	switch {
+	case isDM:
+		if !trig.directMessages {
+			slog.Debug("direct message ignored, trigger disabled", "channel", ev.Channel, "user", ev.User)
+			return
+		}
+		if msg.ThreadTS == "" {
+			msg.ThreadTS = ev.TimeStamp
+		}
+
+	case isStopCommand(msg.Text):
+		// Anyone the access rules allow may stop a running investigation,
+		// whether or not thread replies are enabled. Nothing to stop is not
+		// worth a reply.
+		g.requestStop(msg, "reply", func(stopped bool) {
+			if stopped {
+				g.seen.markSeen(messageKey(ev.Channel, ev.TimeStamp))
+			}
+		})
+		return
+
+	case !trig.threadReplies:
+		return
+	}
+
+	g.accept(evt, callbackEventID(eventsAPIEvent), ev.TimeStamp, msg, !isDM, pool)
+}
+
+// accept drops redelivered events, handles stop commands, refuses requests
+// the access rules deny and queues everything else for investigation. With
+// threadReply set, the message is only taken if the bot participates in the
+// thread. Everything that needs the Slack API runs on the intake, not on the
+// event loop.
+func (g *Gateway) accept(evt *socketmode.Event, eventID, ts string, msg Message, threadReply bool, pool *workerPool) {
+	if g.seen.markSeen(eventKey(eventID), messageKey(msg.Channel, ts)) {
+		duplicateEventsDropped.Add(1)
+		slog.Info("duplicate event dropped",
+			"event_id", eventID,
+			"channel", msg.Channel,
+			"ts", ts,
+			"retry_attempt", evt.Request.RetryAttempt,
+			"retry_reason", evt.Request.RetryReason,
+		)
+		return
+	}
+
+	if isStopCommand(msg.Text) {
+		g.requestStop(msg, "reply", func(stopped bool) {
+			if stopped {
+				return
+			}
+			if err := g.PostMessage(msg.Channel, msg.ThreadTS, "Nothing is running in this thread."); err != nil {
+				slog.Error("failed to send stop reply", "error", err, "thread", msg.ThreadTS)
+			}
+		})
+		return
+	}
+
+	g.intake.run(threadKey(msg), func() {
+		if threadReply && !g.participates(msg) {
+			return
+		}
+
+		slog.Debug("message accepted",
+			"user", msg.UserID,
+			"channel", msg.Channel,
+			"thread", msg.ThreadTS,
+			"text", msg.Text,
+		)
+
+		access := g.checkAccess(msg)
+		if !access.allowed {
+			slog.Info("request denied", "user", msg.UserID, "channel", msg.Channel, "thread", msg.ThreadTS, "rule", access.rule)
+			g.refuse(msg)
+			return
+		}
+		msg.Playbooks, msg.Agents = access.playbooks, access.agents
+
+		msg.UserName = g.userName(msg.UserID)
+		g.threads.join(threadKey(msg))
+		if errors.Is(pool.submit(msg), errQueueFull) {
+			text := "I'm handling too many requests right now. Please try again in a few minutes."
+			if err := g.PostMessage(msg.Channel, msg.ThreadTS, text); err != nil {
+				slog.Error("failed to send queue rejection", "error", err, "thread", msg.ThreadTS)
+			}
+		}
+	})
+}
+
+func callbackEventID(e slackevents.EventsAPIEvent) string {
+	if cb, ok := e.Data.(*slackevents.EventsAPICallbackEvent); ok {
+		return cb.EventID
+	}
+	return ""
+}
+
+// participates reports whether the bot is part of msg's thread: it has been
+// asked something there, or, after a restart, has posted in it.
+func (g *Gateway) participates(msg Message) bool {
+	key := threadKey(msg)
+	if joined, known := g.threads.lookup(key); known {
+		return joined
+	}
+
+	joined := false
+	replies, _, _, err := g.api.GetConversationReplies(&slack.GetConversationRepliesParameters{
+		ChannelID: msg.Channel,
+		Timestamp: msg.ThreadTS,
+		Limit:     threadLookupLimit,
+	})
+	if err != nil {
+		slog.Error("failed to fetch thread replies", "error", err, "thread", msg.ThreadTS)
+		return false
+	}
+	for _, reply := range replies {
+		if reply.User == g.botID {
+			joined = true
+			break
+		}
+	}
+	g.threads.remember(key, joined)
+	return joined
+}
+
+// threadTracker remembers which threads the bot takes part in.
+type threadTracker struct {
+	mu      sync.Mutex
+	threads map[string]threadEntry
+}
+
+type threadEntry struct {
+	joined  bool
+	expires time.Time
+}
+
+func newThreadTracker() *threadTracker {
+	return &threadTracker{threads: make(map[string]threadEntry)}
+}
+
+func (t *threadTracker) join(key string) {
+	t.remember(key, true)
+}
+
+func (t *threadTracker) remember(key string, joined bool) {
+	ttl := nonParticipationTTL
+	if joined {
+		ttl = participationTTL
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for k, e := range t.threads {
+		if now.After(e.expires) {
+			delete(t.threads, k)
+		}
+	}
+	t.threads[key] = threadEntry{joined: joined, expires: now.Add(ttl)}
+}
+
+func (t *threadTracker) lookup(key string) (joined, known bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.threads[key]
+	if !ok || time.Now().After(e.expires) {
+		return false, false
+	}
+	return e.joined, true
+}